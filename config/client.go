@@ -0,0 +1,182 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// NewS3Client creates an S3 client using the region, credentials mode,
+// endpoint and TLS settings from the config.
+func (c Config) NewS3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := c.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if c.AWSEndpoint != "" {
+			o.BaseEndpoint = aws.String(c.AWSEndpoint)
+		}
+		o.UsePathStyle = c.AWSUsePathStyle
+	}), nil
+}
+
+// NewSQSClient creates an SQS client using the region, credentials mode and
+// TLS settings from the config. The endpoint overrides the default SQS
+// endpoint if set, e.g. to use an SQS-compatible queue.
+func (c Config) NewSQSClient(ctx context.Context, endpoint string) (*sqs.Client, error) {
+	cfg, err := c.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	}), nil
+}
+
+// loadAWSConfig loads the AWS config with a credentials provider matching
+// the configured credentials mode.
+func (c Config) loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	baseOpts := []func(*awsConfig.LoadOptions) error{
+		awsConfig.WithRegion(c.AWSRegion),
+	}
+	if c.AWSTLSCABundle != "" || c.AWSTLSInsecureSkipVerify {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return aws.Config{}, err
+		}
+		baseOpts = append(baseOpts, awsConfig.WithHTTPClient(
+			awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+				tr.TLSClientConfig = tlsConfig
+			}),
+		))
+	}
+
+	opts := baseOpts
+	if c.hasStaticCredentials() {
+		opts = append(slices.Clone(baseOpts), awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(
+				c.AWSAccessKeyID,
+				c.AWSSecretAccessKey,
+				c.AWSSessionToken,
+			),
+		))
+	}
+
+	switch c.AWSCredentialsMode {
+	case CredentialsModeStatic, "":
+		if !c.hasStaticCredentials() {
+			return aws.Config{}, fmt.Errorf("static credentials mode requires %q and %q", ConfigKeyAWSAccessKeyID, ConfigKeyAWSSecretAccessKey)
+		}
+		return c.load(ctx, opts...)
+	case CredentialsModeDefault:
+		return c.load(ctx, baseOpts...)
+	case CredentialsModeAssumeRole:
+		// the base config is used to call STS, it uses the static keys if
+		// provided, otherwise the default credential chain
+		base, err := c.load(ctx, opts...)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		base.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(
+			sts.NewFromConfig(base),
+			c.AWSRoleARN,
+			func(o *stscreds.AssumeRoleOptions) {
+				if c.AWSExternalID != "" {
+					o.ExternalID = aws.String(c.AWSExternalID)
+				}
+				if c.AWSRoleSessionName != "" {
+					o.RoleSessionName = c.AWSRoleSessionName
+				}
+			},
+		))
+		return base, nil
+	case CredentialsModeWebIdentity:
+		// assuming a role with a web identity is an unsigned call, the base
+		// config only needs the region
+		base, err := c.load(ctx, baseOpts...)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		base.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+			sts.NewFromConfig(base),
+			c.AWSRoleARN,
+			stscreds.IdentityTokenFile(c.AWSWebIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				if c.AWSRoleSessionName != "" {
+					o.RoleSessionName = c.AWSRoleSessionName
+				}
+			},
+		))
+		return base, nil
+	default:
+		return aws.Config{}, fmt.Errorf("unsupported credentials mode: %q", c.AWSCredentialsMode)
+	}
+}
+
+func (c Config) load(ctx context.Context, opts ...func(*awsConfig.LoadOptions) error) (aws.Config, error) {
+	cfg, err := awsConfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed loading AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+// tlsConfig builds the TLS config used by the HTTP client. The custom CA
+// bundle is trusted in addition to the system certificates.
+func (c Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.AWSTLSInsecureSkipVerify, //nolint:gosec // opt-in via config
+	}
+
+	if c.AWSTLSCABundle != "" {
+		pem, err := os.ReadFile(c.AWSTLSCABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading CA bundle %q: %w", c.AWSTLSCABundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %q", c.AWSTLSCABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+func (c Config) hasStaticCredentials() bool {
+	return c.AWSAccessKeyID != "" && c.AWSSecretAccessKey != ""
+}
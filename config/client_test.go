@@ -0,0 +1,61 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestConfig_NewS3Client_Endpoint(t *testing.T) {
+	is := is.New(t)
+	cfg := Config{
+		AWSCredentialsMode: CredentialsModeStatic,
+		AWSAccessKeyID:     "access-key-123",
+		AWSSecretAccessKey: "secret-key-321",
+		AWSRegion:          "us-east-1",
+		AWSEndpoint:        "http://localhost:9000",
+		AWSUsePathStyle:    true,
+	}
+
+	client, err := cfg.NewS3Client(context.Background())
+	is.NoErr(err)
+
+	opts := client.Options()
+	is.True(opts.BaseEndpoint != nil)
+	is.Equal(*opts.BaseEndpoint, "http://localhost:9000")
+	is.True(opts.UsePathStyle)
+}
+
+func TestConfig_NewS3Client_InvalidCABundle(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	is.NoErr(os.WriteFile(path, []byte("not a certificate"), 0o600))
+
+	cfg := Config{
+		AWSCredentialsMode: CredentialsModeStatic,
+		AWSAccessKeyID:     "access-key-123",
+		AWSSecretAccessKey: "secret-key-321",
+		AWSRegion:          "us-east-1",
+		AWSTLSCABundle:     path,
+	}
+
+	_, err := cfg.NewS3Client(context.Background())
+	is.True(err != nil)
+}
@@ -14,13 +14,50 @@
 
 package config
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
 const (
+	// ConfigKeyAWSCredentialsMode is the config name for the AWS credentials mode
+	ConfigKeyAWSCredentialsMode = "aws.credentialsMode"
+
 	// ConfigKeyAWSAccessKeyID is the config name for AWS access secret key
 	ConfigKeyAWSAccessKeyID = "aws.accessKeyId"
 
 	// ConfigKeyAWSSecretAccessKey is the config name for AWS secret access key
 	ConfigKeyAWSSecretAccessKey = "aws.secretAccessKey"
 
+	// ConfigKeyAWSSessionToken is the config name for AWS session token
+	ConfigKeyAWSSessionToken = "aws.sessionToken"
+
+	// ConfigKeyAWSRoleARN is the config name for the ARN of the AWS role to assume
+	ConfigKeyAWSRoleARN = "aws.roleArn"
+
+	// ConfigKeyAWSExternalID is the config name for the external ID used when assuming a role
+	ConfigKeyAWSExternalID = "aws.externalId"
+
+	// ConfigKeyAWSRoleSessionName is the config name for the session name used when assuming a role
+	ConfigKeyAWSRoleSessionName = "aws.roleSessionName"
+
+	// ConfigKeyAWSWebIdentityTokenFile is the config name for the path to the web identity token file
+	ConfigKeyAWSWebIdentityTokenFile = "aws.webIdentityTokenFile"
+
+	// ConfigKeyAWSEndpoint is the config name for a custom S3 endpoint
+	ConfigKeyAWSEndpoint = "aws.endpoint"
+
+	// ConfigKeyAWSUsePathStyle is the config name for enabling path-style addressing
+	ConfigKeyAWSUsePathStyle = "aws.usePathStyle"
+
+	// ConfigKeyAWSTLSCABundle is the config name for the path to a custom CA bundle
+	ConfigKeyAWSTLSCABundle = "aws.tls.caBundle"
+
+	// ConfigKeyAWSTLSInsecureSkipVerify is the config name for skipping TLS certificate verification
+	ConfigKeyAWSTLSInsecureSkipVerify = "aws.tls.insecureSkipVerify"
+
 	// ConfigKeyAWSRegion is the config name for AWS region
 	ConfigKeyAWSRegion = "aws.region"
 
@@ -31,12 +68,59 @@ const (
 	ConfigKeyPrefix = "prefix"
 )
 
+// CredentialsMode defines how the connector obtains AWS credentials.
+type CredentialsMode string
+
+const (
+	// CredentialsModeStatic uses the configured access key ID and secret access key.
+	CredentialsModeStatic CredentialsMode = "static"
+
+	// CredentialsModeDefault uses the default AWS credential chain (environment
+	// variables, shared config files, EC2 instance profiles, ECS task roles, IRSA).
+	CredentialsModeDefault CredentialsMode = "default"
+
+	// CredentialsModeAssumeRole assumes the configured role using STS. The role
+	// is assumed with the static keys if they are set, otherwise with
+	// credentials from the default chain.
+	CredentialsModeAssumeRole CredentialsMode = "assumeRole"
+
+	// CredentialsModeWebIdentity assumes the configured role using the web
+	// identity token stored in the configured token file.
+	CredentialsModeWebIdentity CredentialsMode = "webIdentity"
+)
+
 // Config represents configuration needed for S3
 type Config struct {
-	// AWS access key id.
-	AWSAccessKeyID string `json:"aws.accessKeyId" validate:"required"`
-	// AWS secret access key.
-	AWSSecretAccessKey string `json:"aws.secretAccessKey" validate:"required"`
+	// the way AWS credentials are obtained, one of "static", "default",
+	// "assumeRole" or "webIdentity".
+	AWSCredentialsMode CredentialsMode `json:"aws.credentialsMode" default:"static" validate:"inclusion=static|default|assumeRole|webIdentity"`
+	// AWS access key id, required if the credentials mode is "static".
+	AWSAccessKeyID string `json:"aws.accessKeyId"`
+	// AWS secret access key, required if the credentials mode is "static".
+	AWSSecretAccessKey string `json:"aws.secretAccessKey"`
+	// AWS session token, optionally used together with static keys.
+	AWSSessionToken string `json:"aws.sessionToken"`
+	// the ARN of the role to assume, required if the credentials mode is
+	// "assumeRole" or "webIdentity".
+	AWSRoleARN string `json:"aws.roleArn"`
+	// the external ID used when assuming the role.
+	AWSExternalID string `json:"aws.externalId"`
+	// the session name used when assuming the role.
+	AWSRoleSessionName string `json:"aws.roleSessionName" default:"conduit-connector-s3"`
+	// path to the web identity token file, required if the credentials mode
+	// is "webIdentity".
+	AWSWebIdentityTokenFile string `json:"aws.webIdentityTokenFile"`
+	// a custom S3 endpoint URL, used to connect to S3-compatible stores like
+	// MinIO, Ceph RGW or Cloudflare R2.
+	AWSEndpoint string `json:"aws.endpoint"`
+	// use path-style addressing (https://host/bucket/key) instead of
+	// virtual-hosted-style addressing (https://bucket.host/key).
+	AWSUsePathStyle bool `json:"aws.usePathStyle" default:"false"`
+	// path to a PEM encoded CA bundle that is trusted in addition to the
+	// system certificates.
+	AWSTLSCABundle string `json:"aws.tls.caBundle"`
+	// skip TLS certificate verification, only meant for development setups.
+	AWSTLSInsecureSkipVerify bool `json:"aws.tls.insecureSkipVerify" default:"false"`
 	// the AWS S3 bucket region
 	AWSRegion string `json:"aws.region" validate:"required"`
 	// the AWS S3 bucket name.
@@ -44,3 +128,50 @@ type Config struct {
 	// the S3 key prefix.
 	Prefix string
 }
+
+// Validate checks that the settings required by the chosen credentials mode
+// are present and that the custom endpoint, if any, is a valid URL.
+func (c *Config) Validate(context.Context) error {
+	var errs []error
+
+	switch c.AWSCredentialsMode {
+	case CredentialsModeStatic, "":
+		if c.AWSAccessKeyID == "" {
+			errs = append(errs, c.requiredForModeErr(ConfigKeyAWSAccessKeyID))
+		}
+		if c.AWSSecretAccessKey == "" {
+			errs = append(errs, c.requiredForModeErr(ConfigKeyAWSSecretAccessKey))
+		}
+	case CredentialsModeDefault:
+		// nothing to check, credentials are resolved at runtime
+	case CredentialsModeAssumeRole:
+		if c.AWSRoleARN == "" {
+			errs = append(errs, c.requiredForModeErr(ConfigKeyAWSRoleARN))
+		}
+		if (c.AWSAccessKeyID == "") != (c.AWSSecretAccessKey == "") {
+			errs = append(errs, fmt.Errorf("%q and %q need to be set together", ConfigKeyAWSAccessKeyID, ConfigKeyAWSSecretAccessKey))
+		}
+	case CredentialsModeWebIdentity:
+		if c.AWSRoleARN == "" {
+			errs = append(errs, c.requiredForModeErr(ConfigKeyAWSRoleARN))
+		}
+		if c.AWSWebIdentityTokenFile == "" {
+			errs = append(errs, c.requiredForModeErr(ConfigKeyAWSWebIdentityTokenFile))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported credentials mode: %q", c.AWSCredentialsMode))
+	}
+
+	if c.AWSEndpoint != "" {
+		u, err := url.Parse(c.AWSEndpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%q must be an absolute URL, got %q", ConfigKeyAWSEndpoint, c.AWSEndpoint))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) requiredForModeErr(key string) error {
+	return fmt.Errorf("%q is required when %q is %q", key, ConfigKeyAWSCredentialsMode, c.AWSCredentialsMode)
+}
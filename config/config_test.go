@@ -15,6 +15,7 @@
 package config
 
 import (
+	"context"
 	"testing"
 
 	"github.com/conduitio/conduit-commons/config"
@@ -43,3 +44,84 @@ func TestParseConfig(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(want, got)
 }
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{{
+		name: "static with keys",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeStatic,
+			AWSAccessKeyID:     "access-key-123",
+			AWSSecretAccessKey: "secret-key-321",
+		},
+	}, {
+		name: "static without keys",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeStatic,
+		},
+		wantErr: true,
+	}, {
+		name: "default without keys",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeDefault,
+		},
+	}, {
+		name: "assume role without keys",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeAssumeRole,
+			AWSRoleARN:         "arn:aws:iam::123456789012:role/conduit",
+		},
+	}, {
+		name: "assume role without role ARN",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeAssumeRole,
+		},
+		wantErr: true,
+	}, {
+		name: "assume role with partial keys",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeAssumeRole,
+			AWSRoleARN:         "arn:aws:iam::123456789012:role/conduit",
+			AWSAccessKeyID:     "access-key-123",
+		},
+		wantErr: true,
+	}, {
+		name: "web identity",
+		config: Config{
+			AWSCredentialsMode:      CredentialsModeWebIdentity,
+			AWSRoleARN:              "arn:aws:iam::123456789012:role/conduit",
+			AWSWebIdentityTokenFile: "/var/run/secrets/token",
+		},
+	}, {
+		name: "web identity without token file",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeWebIdentity,
+			AWSRoleARN:         "arn:aws:iam::123456789012:role/conduit",
+		},
+		wantErr: true,
+	}, {
+		name: "valid endpoint",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeDefault,
+			AWSEndpoint:        "https://minio.local:9000",
+		},
+	}, {
+		name: "endpoint without scheme",
+		config: Config{
+			AWSCredentialsMode: CredentialsModeDefault,
+			AWSEndpoint:        "minio.local:9000",
+		},
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			err := tc.config.Validate(context.Background())
+			is.Equal(tc.wantErr, err != nil)
+		})
+	}
+}
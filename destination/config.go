@@ -15,14 +15,39 @@
 package destination
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/conduitio/conduit-connector-s3/config"
 	"github.com/conduitio/conduit-connector-s3/destination/format"
+	"github.com/conduitio/conduit-connector-s3/destination/writer"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 )
 
 const (
 	// ConfigKeyFormat is the config name for destination format.
 	ConfigKeyFormat = "format"
+
+	// ConfigKeyKeyTemplate is the config name for the object key template.
+	ConfigKeyKeyTemplate = "keyTemplate"
+
+	// ConfigKeyMode is the config name for the write mode.
+	ConfigKeyMode = "mode"
+
+	// ConfigKeyCSVDelimiter is the config name for the CSV field delimiter.
+	ConfigKeyCSVDelimiter = "csv.delimiter"
+)
+
+// Mode defines how records are written to objects.
+type Mode string
+
+const (
+	// ModeBatch writes each batch of records to a file in the format.
+	ModeBatch Mode = "batch"
+	// ModeMirror writes each record to its own object and deletes the
+	// object of deleted records.
+	ModeMirror Mode = "mirror"
 )
 
 // Config represents S3 configuration with Destination specific configurations
@@ -30,6 +55,116 @@ type Config struct {
 	sdk.DefaultDestinationMiddleware
 	config.Config
 
-	// the destination format, either "json" or "parquet".
-	Format format.Format `validate:"required,inclusion=parquet|json"`
+	// how records are written, "batch" writes each batch of records to a
+	// file in the format, "mirror" writes the payload of each record to its
+	// own object named after the record key (or keyTemplate) and deletes the
+	// object of deleted records, restoring the content type
+	// ("s3.header.contentType") and user metadata read by the S3 source.
+	Mode Mode `json:"mode" default:"batch" validate:"inclusion=batch|mirror"`
+	// the destination format, either "json", "parquet", "csv" or "avro",
+	// required if the mode is "batch".
+	Format format.Format `validate:"inclusion=parquet|json|csv|avro"`
+	// Go template rendering the key of the object a record is written to,
+	// e.g. "{{.Collection}}/dt={{.Time \"2006-01-02\"}}/{{.UUID}}.{{.Ext}}".
+	// Records of a batch with different keys are written to different
+	// objects. The template can use .Collection, .Operation, .Time "layout"
+	// (creation time, or read time if unknown, in UTC), .ReadAt "layout",
+	// .Metadata "key", .Field "path" (payload field, e.g. "customer.id"),
+	// .Key, .UUID (one per object) and .Ext. Keys are prefixed with the
+	// prefix. If empty, each batch is written to
+	// "<unix nano timestamp>.<ext>", or each record to an object named after
+	// its key in the "mirror" mode.
+	KeyTemplate string `json:"keyTemplate"`
+	// CSV configures the "csv" format.
+	CSV CSVConfig `json:"csv"`
+	// Parquet configures the "parquet" format.
+	Parquet ParquetConfig `json:"parquet"`
+}
+
+// ParquetConfig contains the options for writing Parquet files.
+type ParquetConfig struct {
+	// whether payloads are written as typed columns instead of a single
+	// string column. The columns are derived from the payload schema of the
+	// records ("opencdc.payload.schema.subject" and
+	// "opencdc.payload.schema.version"), or inferred from structured payloads
+	// and raw payloads containing JSON objects. A new file is started when the
+	// schema changes.
+	Typed bool `json:"typed" default:"false"`
+}
+
+// CSVConfig contains the options for writing CSV files.
+type CSVConfig struct {
+	// payload fields written as columns, nested fields are separated by dots
+	// (e.g. "customer.id"). Structured payloads and raw payloads containing
+	// JSON objects are flattened into the columns, fields that are not a
+	// column are dropped. If empty, each file's columns are the fields of the
+	// payload schema of its first record, or the fields of its first
+	// record's payload sorted by name.
+	Columns []string `json:"columns"`
+	// the character separating fields.
+	Delimiter string `json:"delimiter" default:","`
+	// whether the first row of each file contains the column names.
+	Header bool `json:"header" default:"true"`
+	// whether the operation of the record is written in the first column,
+	// named "_operation".
+	IncludeOperation bool `json:"includeOperation" default:"false"`
+	// whether the position of the record is written in a column after the
+	// operation, named "_position".
+	IncludePosition bool `json:"includePosition" default:"false"`
+	// metadata keys written as columns before the payload columns, the
+	// columns are named after the keys (e.g. "opencdc.collection").
+	MetadataColumns []string `json:"metadataColumns"`
+}
+
+// Options converts the config into the options of the CSV format.
+func (c CSVConfig) Options() (format.CSVOptions, error) {
+	delimiter := []rune(c.Delimiter)
+	if len(delimiter) != 1 || delimiter[0] == '"' || delimiter[0] == '\r' || delimiter[0] == '\n' {
+		return format.CSVOptions{}, fmt.Errorf("%q: invalid delimiter %q, expected a single character other than a quote or line break", ConfigKeyCSVDelimiter, c.Delimiter)
+	}
+	return format.CSVOptions{
+		Columns:   c.Columns,
+		Delimiter: delimiter[0],
+		Header:    c.Header,
+		Operation: c.IncludeOperation,
+		Position:  c.IncludePosition,
+		Metadata:  c.MetadataColumns,
+	}, nil
+}
+
+// FormatOptions returns the options of the format.
+func (c *Config) FormatOptions() (format.Options, error) {
+	var opts format.Options
+	switch c.Format {
+	case format.CSV:
+		csvOpts, err := c.CSV.Options()
+		if err != nil {
+			return format.Options{}, err
+		}
+		opts.CSV = csvOpts
+	case format.Parquet:
+		opts.Parquet = format.ParquetOptions{Typed: c.Parquet.Typed}
+	}
+	return opts, nil
+}
+
+// Validate runs the SDK middleware validation and the shared S3 config
+// validation.
+func (c *Config) Validate(ctx context.Context) error {
+	var keyTemplateErr error
+	if c.KeyTemplate != "" {
+		_, keyTemplateErr = writer.ParseKeyTemplate(c.KeyTemplate)
+	}
+	var formatErr error
+	if c.Mode == ModeBatch && c.Format == "" {
+		formatErr = fmt.Errorf("%q is required if %q is %q", ConfigKeyFormat, ConfigKeyMode, ModeBatch)
+	}
+	_, formatOptionsErr := c.FormatOptions()
+	return errors.Join(
+		c.DefaultDestinationMiddleware.Validate(ctx),
+		c.Config.Validate(ctx),
+		keyTemplateErr,
+		formatErr,
+		formatOptionsErr,
+	)
 }
@@ -47,3 +47,32 @@ func TestParseConfig(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(want, got)
 }
+
+func TestCSVConfig_Options(t *testing.T) {
+	testCases := []struct {
+		delimiter string
+		want      rune
+		wantErr   bool
+	}{
+		{delimiter: ",", want: ','},
+		{delimiter: ";", want: ';'},
+		{delimiter: "\t", want: '\t'},
+		{delimiter: "", wantErr: true},
+		{delimiter: ";;", wantErr: true},
+		{delimiter: "\"", wantErr: true},
+		{delimiter: "\n", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.delimiter, func(t *testing.T) {
+			is := is.New(t)
+			opts, err := CSVConfig{Delimiter: tc.delimiter, Header: true}.Options()
+			if tc.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(opts.Delimiter, tc.want)
+			is.True(opts.Header)
+		})
+	}
+}
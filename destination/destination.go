@@ -18,6 +18,7 @@ import (
 	"context"
 
 	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
 	"github.com/conduitio/conduit-connector-s3/destination/writer"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 )
@@ -28,8 +29,9 @@ import (
 type Destination struct {
 	sdk.UnimplementedDestination
 
-	config Config
-	Writer writer.Writer
+	config        Config
+	formatOptions format.Options
+	Writer        writer.Writer
 }
 
 func NewDestination() sdk.Destination {
@@ -43,19 +45,21 @@ func (d *Destination) Config() sdk.DestinationConfig {
 // Open makes sure everything is prepared to receive records.
 func (d *Destination) Open(ctx context.Context) error {
 	// initializing the writer
-	w, err := writer.NewS3(ctx, &writer.S3Config{
-		AccessKeyID:     d.config.AWSAccessKeyID,
-		SecretAccessKey: d.config.AWSSecretAccessKey,
-		Region:          d.config.AWSRegion,
-		Bucket:          d.config.AWSBucket,
-		KeyPrefix:       d.config.Prefix,
-	})
+	cfg := &writer.S3Config{
+		Config:      d.config.Config,
+		KeyTemplate: d.config.KeyTemplate,
+	}
+	var err error
+	d.formatOptions, err = d.config.FormatOptions()
 	if err != nil {
 		return err
 	}
-
-	d.Writer = w
-	return nil
+	if d.config.Mode == ModeMirror {
+		d.Writer, err = writer.NewMirror(ctx, cfg)
+	} else {
+		d.Writer, err = writer.NewS3(ctx, cfg)
+	}
+	return err
 }
 
 // Write writes a slice of records into a Destination.
@@ -63,6 +67,7 @@ func (d *Destination) Write(ctx context.Context, records []opencdc.Record) (int,
 	err := d.Writer.Write(ctx, &writer.Batch{
 		Records: records,
 		Format:  d.config.Format,
+		Options: d.formatOptions,
 	})
 	if err != nil {
 		return 0, err
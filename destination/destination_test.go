@@ -38,6 +38,7 @@ const (
 	EnvAWSSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
 	EnvAWSS3Bucket        = "AWS_S3_BUCKET"
 	EnvAWSRegion          = "AWS_REGION"
+	EnvAWSS3Endpoint      = "AWS_S3_ENDPOINT"
 )
 
 func TestLocalParquet(t *testing.T) {
@@ -52,6 +53,11 @@ func TestLocalParquet(t *testing.T) {
 		config.ConfigKeyAWSBucket:          "foobucket",
 		destination.ConfigKeyFormat:        "parquet",
 	}
+	// optional, used to run the test against an S3-compatible store
+	if endpoint := os.Getenv(EnvAWSS3Endpoint); endpoint != "" {
+		cfg[config.ConfigKeyAWSEndpoint] = endpoint
+		cfg[config.ConfigKeyAWSUsePathStyle] = "true"
+	}
 	err := sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().DestinationParams)
 	is.NoErr(err) // failed to parse the configuration
 
@@ -165,6 +171,11 @@ func TestS3Parquet(t *testing.T) {
 		config.ConfigKeyPrefix:             "test",
 		destination.ConfigKeyFormat:        "parquet",
 	}
+	// optional, used to run the test against an S3-compatible store
+	if endpoint := os.Getenv(EnvAWSS3Endpoint); endpoint != "" {
+		cfg[config.ConfigKeyAWSEndpoint] = endpoint
+		cfg[config.ConfigKeyAWSUsePathStyle] = "true"
+	}
 
 	err := sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().DestinationParams)
 	is.NoErr(err) // failed to parse the configuration
@@ -192,10 +203,7 @@ func TestS3Parquet(t *testing.T) {
 	is.Equal(len(writer.FilesWritten), 2) // Expected writer to have written 2 files
 
 	validator := &filevalidator.S3{
-		AccessKeyID:     env[EnvAWSAccessKeyID],
-		SecretAccessKey: env[EnvAWSSecretAccessKey],
-		Bucket:          env[EnvAWSS3Bucket],
-		Region:          env[EnvAWSRegion],
+		Config: underTest.Config().(*destination.Config).Config,
 	}
 
 	err = validateReferences(
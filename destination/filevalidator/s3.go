@@ -20,43 +20,27 @@ import (
 	"io"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/conduitio/conduit-connector-s3/config"
 )
 
 // S3 validates S3 files
 type S3 struct {
-	AccessKeyID     string
-	SecretAccessKey string
-	Region          string
-	Bucket          string
+	Config config.Config
 }
 
 // Validate takes a name of an S3 file and compares the contents of a file with
 // this name to a byte-slice returning an error if they don't match.
 func (v *S3) Validate(name string, reference []byte) error {
-	awsCredsProvider := credentials.NewStaticCredentialsProvider(
-		v.AccessKeyID,
-		v.SecretAccessKey,
-		"",
-	)
-
-	awsConfig, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion(v.Region),
-		config.WithCredentialsProvider(awsCredsProvider),
-	)
+	client, err := v.Config.NewS3Client(context.TODO())
 	if err != nil {
 		return err
 	}
 
-	client := s3.NewFromConfig(awsConfig)
-
 	object, err := client.GetObject(
 		context.TODO(),
 		&s3.GetObjectInput{
-			Bucket: aws.String(v.Bucket),
+			Bucket: aws.String(v.Config.AWSBucket),
 			Key:    aws.String(name),
 		},
 	)
@@ -83,7 +67,7 @@ func (v *S3) Validate(name string, reference []byte) error {
 	_, err = client.DeleteObject(
 		context.TODO(),
 		&s3.DeleteObjectInput{
-			Bucket: aws.String(v.Bucket),
+			Bucket: aws.String(v.Config.AWSBucket),
 			Key:    aws.String(name),
 		},
 	)
@@ -0,0 +1,116 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+)
+
+// makeAvroBytes writes the payloads of the records to an Avro Object Container
+// File, the file's schema is the payload schema of the records, all records
+// need to have the same schema (see Split). Deletes without a payload are
+// written as null, the schema of a file containing them is a union of null and
+// the payload schema.
+func makeAvroBytes(ctx context.Context, records []opencdc.Record) ([]byte, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+	first := records[0]
+	s, err := payloadSchema(ctx, first)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("record %q has no payload schema, the avro format requires %q and %q", first.Position, opencdc.MetadataPayloadSchemaSubject, opencdc.MetadataPayloadSchemaVersion)
+	}
+
+	fileSchema := avro.Schema(s)
+	nullable := slices.ContainsFunc(records, func(r opencdc.Record) bool {
+		return r.Operation == opencdc.OperationDelete && r.Payload.After == nil && r.Payload.Before == nil
+	})
+	if nullable {
+		fileSchema, err = avro.NewUnionSchema([]avro.Schema{avro.NewNullSchema(), s})
+		if err != nil {
+			return nil, fmt.Errorf("could not create nullable schema of record %q: %w", first.Position, err)
+		}
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	enc, err := ocf.NewEncoderWithSchema(fileSchema, buf)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Avro encoder: %w", err)
+	}
+	for _, r := range records {
+		if payloadSchemaID(r) != payloadSchemaID(first) {
+			return nil, fmt.Errorf("record %q has payload schema %q, expected %q", r.Position, payloadSchemaID(r), payloadSchemaID(first))
+		}
+		v, err := avroValue(s, r)
+		if err != nil {
+			return nil, err
+		}
+		if nullable {
+			v = avroUnionValue(s, v)
+		}
+		if err := enc.Encode(v); err != nil {
+			return nil, fmt.Errorf("could not encode payload of record %q: %w", r.Position, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// avroValue returns the payload after the change, or before the change for
+// deletes, or nil for deletes without a payload. Raw payloads need to be encoded with the schema, they are decoded so
+// payloads that don't match the schema can't corrupt the file.
+func avroValue(s avro.Schema, r opencdc.Record) (any, error) {
+	payload := r.Payload.After
+	if payload == nil {
+		payload = r.Payload.Before
+	}
+	if payload == nil && r.Operation == opencdc.OperationDelete {
+		return nil, nil
+	}
+
+	switch p := payload.(type) {
+	case opencdc.StructuredData:
+		return map[string]any(p), nil
+	case opencdc.RawData:
+		var v any
+		if err := avro.Unmarshal(s, p, &v); err != nil {
+			return nil, fmt.Errorf("could not decode payload of record %q with its schema: %w", r.Position, err)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("record %q has no payload", r.Position)
+	}
+}
+
+// avroUnionValue wraps v in the map Avro encodes unions from, with the name of
+// the type s as key, or no key for null.
+func avroUnionValue(s avro.Schema, v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	return map[string]any{avroTypeName(s): v}
+}
@@ -0,0 +1,143 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-sdk/schema"
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+	"github.com/matryer/is"
+)
+
+func TestMakeAvroBytes(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	s, err := schema.Create(ctx, schema.TypeAvro, "users", []byte(`{
+		"type": "record", "name": "user", "fields": [
+			{"name": "id", "type": "long"},
+			{"name": "name", "type": "string"}
+		]}`))
+	is.NoErr(err)
+	parsed, err := avro.Parse(string(s.Bytes))
+	is.NoErr(err)
+	raw, err := avro.Marshal(parsed, map[string]any{"id": int64(2), "name": "bar"})
+	is.NoErr(err)
+
+	records := []opencdc.Record{
+		schemaRecord("1", s, opencdc.Change{After: opencdc.StructuredData{"id": int64(1), "name": "foo"}}),
+		schemaRecord("2", s, opencdc.Change{After: opencdc.RawData(raw)}),
+		schemaRecord("3", s, opencdc.Change{Before: opencdc.StructuredData{"id": int64(3), "name": "baz"}}),
+	}
+	data, err := Avro.MakeBytes(ctx, records, Options{})
+	is.NoErr(err)
+
+	dec, err := ocf.NewDecoder(bytes.NewReader(data))
+	is.NoErr(err)
+	is.Equal(dec.Schema().String(), parsed.String())
+	var got []map[string]any
+	for dec.HasNext() {
+		var v map[string]any
+		is.NoErr(dec.Decode(&v))
+		got = append(got, v)
+	}
+	is.NoErr(dec.Error())
+	is.Equal(got, []map[string]any{
+		{"id": int64(1), "name": "foo"},
+		{"id": int64(2), "name": "bar"},
+		{"id": int64(3), "name": "baz"},
+	})
+}
+
+func TestMakeAvroBytes_DeleteWithoutPayload(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	s, err := schema.Create(ctx, schema.TypeAvro, "deletes", []byte(`{"type":"record","name":"user","fields":[{"name":"id","type":"long"}]}`))
+	is.NoErr(err)
+	deleted := schemaRecord("2", s, opencdc.Change{})
+	deleted.Operation = opencdc.OperationDelete
+	records := []opencdc.Record{
+		schemaRecord("1", s, opencdc.Change{After: opencdc.StructuredData{"id": int64(1)}}),
+		deleted,
+	}
+	data, err := Avro.MakeBytes(ctx, records, Options{})
+	is.NoErr(err)
+
+	dec, err := ocf.NewDecoder(bytes.NewReader(data))
+	is.NoErr(err)
+	is.Equal(dec.Schema().String(), `["null",{"name":"user","type":"record","fields":[{"name":"id","type":"long"}]}]`)
+	var got []any
+	for dec.HasNext() {
+		var v any
+		is.NoErr(dec.Decode(&v))
+		got = append(got, v)
+	}
+	is.NoErr(dec.Error())
+	is.Equal(got, []any{map[string]any{"user": map[string]any{"id": int64(1)}}, nil})
+
+	// only deletes can be written without a payload
+	_, err = Avro.MakeBytes(ctx, []opencdc.Record{schemaRecord("3", s, opencdc.Change{})}, Options{})
+	is.True(err != nil)
+}
+
+func TestMakeAvroBytes_NoSchema(t *testing.T) {
+	is := is.New(t)
+	records := []opencdc.Record{{
+		Position: opencdc.Position("1"),
+		Metadata: opencdc.Metadata{},
+		Payload:  opencdc.Change{After: opencdc.StructuredData{"id": 1}},
+	}}
+	_, err := Avro.MakeBytes(context.Background(), records, Options{})
+	is.True(err != nil)
+}
+
+func TestFormat_Split(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	v1, err := schema.Create(ctx, schema.TypeAvro, "split", []byte(`{"type":"record","name":"r","fields":[{"name":"a","type":"long"}]}`))
+	is.NoErr(err)
+	v2, err := schema.Create(ctx, schema.TypeAvro, "split", []byte(`{"type":"record","name":"r","fields":[{"name":"a","type":"long"},{"name":"b","type":"string"}]}`))
+	is.NoErr(err)
+	is.True(v1.Version != v2.Version)
+
+	records := []opencdc.Record{
+		schemaRecord("1", v1, opencdc.Change{}),
+		schemaRecord("2", v1, opencdc.Change{}),
+		schemaRecord("3", v2, opencdc.Change{}),
+		schemaRecord("4", v1, opencdc.Change{}),
+	}
+
+	is.Equal(JSON.Split(records, Options{}), [][]opencdc.Record{records})
+	is.Equal(Avro.Split(records, Options{}), [][]opencdc.Record{records[:2], records[2:3], records[3:]})
+}
+
+func schemaRecord(position string, s schema.Schema, payload opencdc.Change) opencdc.Record {
+	r := opencdc.Record{
+		Operation: opencdc.OperationCreate,
+		Position:  opencdc.Position(position),
+		Metadata:  opencdc.Metadata{},
+		Payload:   payload,
+	}
+	r.Metadata.SetPayloadSchemaSubject(s.Subject)
+	r.Metadata.SetPayloadSchemaVersion(s.Version)
+	return r
+}
@@ -0,0 +1,270 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/hamba/avro/v2"
+)
+
+const (
+	// CSVColumnOperation is the name of the column containing the operation
+	// of the record.
+	CSVColumnOperation = "_operation"
+	// CSVColumnPosition is the name of the column containing the position of
+	// the record.
+	CSVColumnPosition = "_position"
+)
+
+// CSVOptions configures how records are written as CSV.
+type CSVOptions struct {
+	// Columns are the payload fields written as columns, nested fields are
+	// separated by dots (e.g. "customer.id"). If empty, the columns are the
+	// fields of the payload schema of the first record, or the fields of the
+	// first record's payload sorted by name.
+	Columns []string
+	// Delimiter separates fields in a row, defaults to a comma.
+	Delimiter rune
+	// Header is true if the first row contains the column names.
+	Header bool
+	// Operation adds the operation of the record as the first column.
+	Operation bool
+	// Position adds the position of the record as a column after the
+	// operation.
+	Position bool
+	// Metadata are the metadata keys added as columns before the payload
+	// columns, the columns are named after the keys.
+	Metadata []string
+}
+
+// makeCSVBytes writes a row per record, structured payloads and raw payloads
+// containing JSON objects are flattened into the columns. Fields that are not
+// a column are dropped, columns missing in a payload are left empty.
+func makeCSVBytes(ctx context.Context, records []opencdc.Record, opts CSVOptions) ([]byte, error) {
+	rows := make([]map[string]any, len(records))
+	for i, r := range records {
+		fields, err := payloadFields(r)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = make(map[string]any)
+		flatten("", fields, rows[i])
+	}
+
+	columns := opts.Columns
+	if len(columns) == 0 && len(records) > 0 {
+		var err error
+		columns, err = csvColumns(ctx, records[0], rows[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	w := csv.NewWriter(buf)
+	if opts.Delimiter != 0 {
+		w.Comma = opts.Delimiter
+	}
+
+	if opts.Header {
+		header := opts.extraColumns()
+		header = append(header, columns...)
+		if err := w.Write(header); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, r := range records {
+		row := opts.extraValues(r)
+		for _, c := range columns {
+			v, err := csvValue(rows[i][c])
+			if err != nil {
+				return nil, fmt.Errorf("could not write column %q of record %q: %w", c, r.Position, err)
+			}
+			row = append(row, v)
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// extraColumns returns the names of the operation, position and metadata
+// columns that are enabled.
+func (o CSVOptions) extraColumns() []string {
+	var columns []string
+	if o.Operation {
+		columns = append(columns, CSVColumnOperation)
+	}
+	if o.Position {
+		columns = append(columns, CSVColumnPosition)
+	}
+	return append(columns, o.Metadata...)
+}
+
+// extraValues returns the values of the columns returned by extraColumns.
+func (o CSVOptions) extraValues(r opencdc.Record) []string {
+	var values []string
+	if o.Operation {
+		values = append(values, r.Operation.String())
+	}
+	if o.Position {
+		values = append(values, string(r.Position))
+	}
+	for _, key := range o.Metadata {
+		values = append(values, r.Metadata[key])
+	}
+	return values
+}
+
+// payloadFields returns the fields of the payload after the change, or before
+// the change for deletes. Raw payloads need to contain a JSON object.
+func payloadFields(r opencdc.Record) (map[string]any, error) {
+	payload := r.Payload.After
+	if payload == nil {
+		payload = r.Payload.Before
+	}
+
+	switch p := payload.(type) {
+	case opencdc.StructuredData:
+		return p, nil
+	case opencdc.RawData:
+		if len(p) == 0 {
+			return nil, nil
+		}
+		var fields map[string]any
+		dec := json.NewDecoder(bytes.NewReader(p))
+		// keep numbers as they are, e.g. amounts don't lose precision
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil {
+			return nil, fmt.Errorf("could not parse payload of record %q as a JSON object: %w", r.Position, err)
+		}
+		return fields, nil
+	default:
+		return nil, nil
+	}
+}
+
+// flatten adds the fields to out, nested fields are added with their names
+// joined by dots.
+func flatten(prefix string, fields map[string]any, out map[string]any) {
+	for name, v := range fields {
+		switch nested := v.(type) {
+		case map[string]any:
+			flatten(prefix+name+".", nested, out)
+		case opencdc.StructuredData:
+			flatten(prefix+name+".", nested, out)
+		default:
+			out[prefix+name] = v
+		}
+	}
+}
+
+// csvColumns returns the columns of a file whose columns are not configured,
+// they are taken from the payload schema of the first record, or from the
+// fields of its payload if it has no schema.
+func csvColumns(ctx context.Context, first opencdc.Record, row map[string]any) ([]string, error) {
+	s, err := payloadSchema(ctx, first)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		return schemaColumns("", s), nil
+	}
+
+	columns := make([]string, 0, len(row))
+	for c := range row {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	return columns, nil
+}
+
+// schemaColumns returns the fields of the record schema in the order they are
+// defined, nested records are flattened like payloads.
+func schemaColumns(prefix string, s *avro.RecordSchema) []string {
+	var columns []string
+	for _, f := range s.Fields() {
+		if nested, ok := nestedRecord(f.Type()); ok {
+			columns = append(columns, schemaColumns(prefix+f.Name()+".", nested)...)
+			continue
+		}
+		columns = append(columns, prefix+f.Name())
+	}
+	return columns
+}
+
+// nestedRecord returns the record schema of a record field or of an optional
+// record field.
+func nestedRecord(s avro.Schema) (*avro.RecordSchema, bool) {
+	switch t := s.(type) {
+	case *avro.RecordSchema:
+		return t, true
+	case *avro.UnionSchema:
+		if !t.Nullable() {
+			return nil, false
+		}
+		_, i := t.Indices()
+		return nestedRecord(t.Types()[i])
+	default:
+		return nil, false
+	}
+}
+
+// csvValue formats a field as a CSV value, lists and maps are written as JSON.
+func csvValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-sdk/schema"
+	"github.com/matryer/is"
+)
+
+func TestMakeCSVBytes(t *testing.T) {
+	records := []opencdc.Record{
+		{
+			Operation: opencdc.OperationCreate,
+			Position:  opencdc.Position("1"),
+			Metadata:  opencdc.Metadata{"opencdc.collection": "orders"},
+			Payload: opencdc.Change{After: opencdc.StructuredData{
+				"id":       1,
+				"amount":   12.5,
+				"customer": map[string]any{"name": "Doe, Jane"},
+			}},
+		},
+		{
+			Operation: opencdc.OperationUpdate,
+			Position:  opencdc.Position("2"),
+			Metadata:  opencdc.Metadata{"opencdc.collection": "orders"},
+			Payload:   opencdc.Change{After: opencdc.RawData(`{"id":2,"amount":0.10000000000000001,"tags":["a"]}`)},
+		},
+		{
+			Operation: opencdc.OperationDelete,
+			Position:  opencdc.Position("3"),
+			Payload:   opencdc.Change{Before: opencdc.StructuredData{"id": 3}},
+		},
+	}
+
+	testCases := []struct {
+		name string
+		opts CSVOptions
+		want string
+	}{{
+		name: "derived columns",
+		opts: CSVOptions{Header: true},
+		want: "amount,customer.name,id\n" +
+			"12.5,\"Doe, Jane\",1\n" +
+			"0.10000000000000001,,2\n" +
+			",,3\n",
+	}, {
+		name: "configured columns",
+		opts: CSVOptions{
+			Columns:   []string{"id", "tags", "missing"},
+			Delimiter: ';',
+			Header:    true,
+			Operation: true,
+			Position:  true,
+			Metadata:  []string{"opencdc.collection"},
+		},
+		want: "_operation;_position;opencdc.collection;id;tags;missing\n" +
+			"create;1;orders;1;;\n" +
+			"update;2;orders;2;\"[\"\"a\"\"]\";\n" +
+			"delete;3;;3;;\n",
+	}, {
+		name: "no header",
+		opts: CSVOptions{Columns: []string{"id"}},
+		want: "1\n2\n3\n",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := CSV.MakeBytes(context.Background(), records, Options{CSV: tc.opts})
+			is.NoErr(err)
+			is.Equal(string(got), tc.want)
+		})
+	}
+}
+
+func TestMakeCSVBytes_SchemaColumns(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	s, err := schema.Create(ctx, schema.TypeAvro, "orders", []byte(`{
+		"type": "record", "name": "order", "fields": [
+			{"name": "id", "type": "long"},
+			{"name": "customer", "type": ["null", {"type": "record", "name": "customer", "fields": [
+				{"name": "name", "type": "string"}
+			]}]},
+			{"name": "amount", "type": "double"}
+		]}`))
+	is.NoErr(err)
+
+	r := opencdc.Record{
+		Metadata: opencdc.Metadata{},
+		Payload: opencdc.Change{After: opencdc.StructuredData{
+			"id":       1,
+			"amount":   12.5,
+			"customer": map[string]any{"name": "Jane"},
+		}},
+	}
+	r.Metadata.SetPayloadSchemaSubject(s.Subject)
+	r.Metadata.SetPayloadSchemaVersion(s.Version)
+
+	got, err := CSV.MakeBytes(ctx, []opencdc.Record{r}, Options{CSV: CSVOptions{Header: true}})
+	is.NoErr(err)
+	is.Equal(string(got), "id,customer.name,amount\n1,Jane,12.5\n")
+}
+
+func TestMakeCSVBytes_InvalidPayload(t *testing.T) {
+	is := is.New(t)
+	records := []opencdc.Record{{
+		Position: opencdc.Position("1"),
+		Payload:  opencdc.Change{After: opencdc.RawData("not json")},
+	}}
+	_, err := CSV.MakeBytes(context.Background(), records, Options{})
+	is.True(err != nil)
+}
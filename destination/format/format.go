@@ -15,6 +15,7 @@
 package format
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/conduitio/conduit-commons/opencdc"
@@ -29,12 +30,20 @@ const (
 
 	// JSON format
 	JSON Format = "json"
+
+	// CSV format https://www.rfc-editor.org/rfc/rfc4180
+	CSV Format = "csv"
+
+	// Avro Object Container File format https://avro.apache.org/
+	Avro Format = "avro"
 )
 
 // All is a variable containing all supported format for enumeration
 var All = []Format{
 	Parquet,
 	JSON,
+	CSV,
+	Avro,
 }
 
 // Parse takes a string and returns a corresponding format or an error
@@ -44,6 +53,10 @@ func Parse(name string) (Format, error) {
 		return Parquet, nil
 	case "json":
 		return JSON, nil
+	case "csv":
+		return CSV, nil
+	case "avro":
+		return Avro, nil
 	default:
 		return "", fmt.Errorf("unsupported format: %q", name)
 	}
@@ -56,6 +69,10 @@ func (f Format) Ext() string {
 		return "parquet"
 	case JSON:
 		return "json"
+	case CSV:
+		return "csv"
+	case Avro:
+		return "avro"
 	default:
 		return "bin"
 	}
@@ -66,19 +83,76 @@ func (f Format) MimeType() string {
 	switch f {
 	case JSON:
 		return "application/json"
+	case CSV:
+		return "text/csv"
+	case Avro:
+		return "application/avro"
 	default:
 		return "application/octet-stream"
 	}
 }
 
+// Options contains the options of the formats that are configurable.
+type Options struct {
+	CSV     CSVOptions
+	Parquet ParquetOptions
+}
+
 // MakeBytes returns a slice of bytes representing records in a given format
-func (f Format) MakeBytes(records []opencdc.Record) ([]byte, error) {
+func (f Format) MakeBytes(ctx context.Context, records []opencdc.Record, opts Options) ([]byte, error) {
 	switch f {
 	case Parquet:
+		if opts.Parquet.Typed {
+			return makeTypedParquetBytes(ctx, records)
+		}
 		return makeParquetBytes(records)
 	case JSON:
 		return makeJSONBytes(records)
+	case CSV:
+		return makeCSVBytes(ctx, records, opts.CSV)
+	case Avro:
+		return makeAvroBytes(ctx, records)
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", f)
 	}
 }
+
+// Split splits the records into the groups that are written to separate
+// files, keeping their order. Avro files and typed Parquet files contain the
+// records of one payload schema, so a new file is started each time the schema
+// changes, or when an inferred payload type conflicts with the previous ones.
+func (f Format) Split(records []opencdc.Record, opts Options) [][]opencdc.Record {
+	switch {
+	case len(records) == 0:
+		return [][]opencdc.Record{records}
+	case f == Parquet && opts.Parquet.Typed:
+		return splitTypedParquet(records)
+	case f == Avro:
+		return splitBySchema(records)
+	default:
+		return [][]opencdc.Record{records}
+	}
+}
+
+// splitBySchema splits the records into consecutive runs with the same
+// payload schema.
+func splitBySchema(records []opencdc.Record) [][]opencdc.Record {
+	var groups [][]opencdc.Record
+	start := 0
+	for i := 1; i < len(records); i++ {
+		if payloadSchemaID(records[i]) != payloadSchemaID(records[start]) {
+			groups = append(groups, records[start:i])
+			start = i
+		}
+	}
+	return append(groups, records[start:])
+}
+
+// dataBytes returns the bytes of data, or nil if data is not set (e.g. the
+// payload of a delete).
+func dataBytes(data opencdc.Data) []byte {
+	if data == nil {
+		return nil
+	}
+	return data.Bytes()
+}
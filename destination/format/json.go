@@ -17,6 +17,9 @@ package format
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 
 	"github.com/conduitio/conduit-commons/opencdc"
 )
@@ -37,8 +40,8 @@ func makeJSONBytes(records []opencdc.Record) ([]byte, error) {
 		r := jsonRecord{
 			Operation: r.Operation.String(),
 			Position:  string(r.Position),
-			Payload:   string(r.Payload.After.Bytes()),
-			Key:       string(r.Key.Bytes()),
+			Payload:   string(dataBytes(r.Payload.After)),
+			Key:       string(dataBytes(r.Key)),
 			Metadata:  r.Metadata,
 		}
 
@@ -53,3 +56,24 @@ func makeJSONBytes(records []opencdc.Record) ([]byte, error) {
 
 	return buf.Bytes(), nil
 }
+
+// jsonReader decodes records written by makeJSONBytes.
+type jsonReader struct {
+	decoder *json.Decoder
+}
+
+func newJSONReader(data io.Reader) *jsonReader {
+	return &jsonReader{decoder: json.NewDecoder(data)}
+}
+
+func (r *jsonReader) Next() (opencdc.Record, error) {
+	var jr jsonRecord
+	err := r.decoder.Decode(&jr)
+	if errors.Is(err, io.EOF) {
+		return opencdc.Record{}, io.EOF
+	}
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("could not decode JSON record: %w", err)
+	}
+	return makeRecord(jr.Operation, jr.Position, jr.Payload, jr.Key, jr.Metadata)
+}
@@ -16,9 +16,12 @@ package format
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 
 	"github.com/conduitio/conduit-commons/opencdc"
 	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
 	"github.com/xitongsys/parquet-go/writer"
 )
 
@@ -45,8 +48,8 @@ func makeParquetBytes(records []opencdc.Record) ([]byte, error) {
 		pr := &parquetRecord{
 			Operation: r.Operation.String(),
 			Position:  string(r.Position),
-			Payload:   string(r.Payload.After.Bytes()),
-			Key:       string(r.Key.Bytes()),
+			Payload:   string(dataBytes(r.Payload.After)),
+			Key:       string(dataBytes(r.Key)),
 			Metadata:  r.Metadata,
 		}
 
@@ -61,3 +64,48 @@ func makeParquetBytes(records []opencdc.Record) ([]byte, error) {
 
 	return buf.Bytes(), nil
 }
+
+// parquetBatchSize is the number of records read from a Parquet file at once.
+const parquetBatchSize = 100
+
+// parquetReader decodes records written by makeParquetBytes.
+type parquetReader struct {
+	reader  *reader.ParquetReader
+	records []parquetRecord
+	read    int64
+}
+
+func newParquetReader(data io.Reader) (*parquetReader, error) {
+	// parquet needs random access to the file, so it is loaded into memory
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not read parquet file: %w", err)
+	}
+	pr, err := reader.NewParquetReader(NewParquetBuffer(b), new(parquetRecord), 1)
+	if err != nil {
+		return nil, fmt.Errorf("could not open parquet file: %w", err)
+	}
+	return &parquetReader{reader: pr}, nil
+}
+
+func (r *parquetReader) Next() (opencdc.Record, error) {
+	if len(r.records) == 0 {
+		remaining := r.reader.GetNumRows() - r.read
+		if remaining <= 0 {
+			r.reader.ReadStop()
+			return opencdc.Record{}, io.EOF
+		}
+		r.records = make([]parquetRecord, min(remaining, parquetBatchSize))
+		if err := r.reader.Read(&r.records); err != nil {
+			return opencdc.Record{}, fmt.Errorf("could not read parquet records: %w", err)
+		}
+		if len(r.records) == 0 {
+			return opencdc.Record{}, io.EOF
+		}
+		r.read += int64(len(r.records))
+	}
+
+	pr := r.records[0]
+	r.records = r.records[1:]
+	return makeRecord(pr.Operation, pr.Position, pr.Payload, pr.Key, pr.Metadata)
+}
@@ -0,0 +1,927 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/hamba/avro/v2"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// ParquetOptions configures how records are written as Parquet.
+type ParquetOptions struct {
+	// Typed writes the payload as typed columns instead of a single string
+	// column. The columns are derived from the payload schema of the records,
+	// or inferred from structured payloads and raw payloads containing JSON
+	// objects.
+	Typed bool
+}
+
+// physical and converted types of typed Parquet columns
+const (
+	parquetBoolean   = "BOOLEAN"
+	parquetInt32     = "INT32"
+	parquetInt64     = "INT64"
+	parquetFloat     = "FLOAT"
+	parquetDouble    = "DOUBLE"
+	parquetByteArray = "BYTE_ARRAY"
+
+	parquetUTF8            = "UTF8"
+	parquetJSON            = "JSON"
+	parquetTimestampMillis = "TIMESTAMP_MILLIS"
+	parquetTimestampMicros = "TIMESTAMP_MICROS"
+	parquetDate            = "DATE"
+	parquetTimeMillis      = "TIME_MILLIS"
+	parquetTimeMicros      = "TIME_MICROS"
+	parquetDecimal         = "DECIMAL"
+)
+
+// maxParquetInt64Precision is the maximum precision of decimals that are
+// written as INT64, larger decimals are written as byte arrays.
+const maxParquetInt64Precision = 18
+
+type parquetKind int
+
+const (
+	parquetPrimitive parquetKind = iota
+	parquetGroup
+	parquetList
+	parquetMap
+)
+
+// parquetType is the type of a typed Parquet column.
+type parquetType struct {
+	kind     parquetKind
+	optional bool
+
+	// physical and converted type of primitives
+	physical  string
+	converted string
+	// precision and scale of decimals, they are written as unscaled integers
+	precision int
+	scale     int
+
+	// fields of groups
+	fields []parquetField
+	// elem is the type of list elements and map values
+	elem *parquetType
+
+	// union is the name of the non-null type of a nullable Avro union, Avro
+	// decodes non-null values of some unions into a map with the name as key
+	union string
+
+	// goType is the Go type the column is marshaled from
+	goType reflect.Type
+}
+
+type parquetField struct {
+	name string
+	typ  *parquetType
+}
+
+func parquetPrimitiveType(physical, converted string) *parquetType {
+	return &parquetType{kind: parquetPrimitive, physical: physical, converted: converted}
+}
+
+// parquetJSONType is the type of values that can't be written as typed
+// columns, e.g. lists of lists, they are written as JSON strings.
+func parquetJSONType() *parquetType {
+	return parquetPrimitiveType(parquetByteArray, parquetJSON)
+}
+
+func (t *parquetType) String() string {
+	var sb strings.Builder
+	t.describe(&sb)
+	return sb.String()
+}
+
+func (t *parquetType) describe(sb *strings.Builder) {
+	if t.optional {
+		sb.WriteByte('?')
+	}
+	switch t.kind {
+	case parquetGroup:
+		sb.WriteByte('{')
+		for i, f := range t.fields {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(sb, "%q:", f.name)
+			f.typ.describe(sb)
+		}
+		sb.WriteByte('}')
+	case parquetList:
+		sb.WriteByte('[')
+		if t.elem != nil {
+			t.elem.describe(sb)
+		}
+		sb.WriteByte(']')
+	case parquetMap:
+		sb.WriteString("map[")
+		t.elem.describe(sb)
+		sb.WriteByte(']')
+	default:
+		sb.WriteString(t.physical)
+		if t.converted != "" {
+			sb.WriteByte('/')
+			sb.WriteString(t.converted)
+		}
+		if t.converted == parquetDecimal {
+			fmt.Fprintf(sb, "(%d,%d)", t.precision, t.scale)
+		}
+	}
+}
+
+// tag returns the parquet struct tag of a field of the type.
+func (t *parquetType) tag(name string) string {
+	tag := "name=" + name
+	switch t.kind {
+	case parquetPrimitive:
+		tag += t.primitiveTag("")
+	case parquetList:
+		tag += ", type=LIST"
+		if t.elem.kind == parquetPrimitive {
+			tag += t.elem.primitiveTag("value")
+		}
+	case parquetMap:
+		tag += ", type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8"
+		tag += t.elem.primitiveTag("value")
+	}
+	return tag
+}
+
+// primitiveTag returns the parquet struct tag options of a primitive type,
+// prefix is prepended to the option names of list elements and map values.
+func (t *parquetType) primitiveTag(prefix string) string {
+	tag := ", " + prefix + "type=" + t.physical
+	if t.converted != "" {
+		tag += ", " + prefix + "convertedtype=" + t.converted
+	}
+	if t.converted == parquetDecimal {
+		tag += fmt.Sprintf(", %sprecision=%d, %sscale=%d", prefix, t.precision, prefix, t.scale)
+	}
+	return tag
+}
+
+// build sets the Go types of the type and its children, it returns an error
+// if a field name can't be used as a column name.
+func (t *parquetType) build() error {
+	// the types of empty groups and lists are unknown, they are written as
+	// JSON
+	if t.kind == parquetGroup && len(t.fields) == 0 {
+		*t = parquetType{kind: parquetPrimitive, physical: parquetByteArray, converted: parquetJSON, optional: t.optional}
+	}
+	if t.kind == parquetList && t.elem == nil {
+		t.elem = parquetJSONType()
+	}
+
+	var base reflect.Type
+	switch t.kind {
+	case parquetGroup:
+		fields := make([]reflect.StructField, len(t.fields))
+		for i, f := range t.fields {
+			if f.name == "" || strings.ContainsAny(f.name, ",\t\x01") {
+				return fmt.Errorf("field name %q can't be used as a Parquet column name", f.name)
+			}
+			if err := f.typ.build(); err != nil {
+				return err
+			}
+			fields[i] = reflect.StructField{
+				Name: fmt.Sprintf("F%d", i),
+				Type: f.typ.goType,
+				Tag:  reflect.StructTag(fmt.Sprintf("parquet:%q", f.typ.tag(f.name))),
+			}
+		}
+		base = reflect.StructOf(fields)
+	case parquetList:
+		if err := t.elem.build(); err != nil {
+			return err
+		}
+		base = reflect.SliceOf(t.elem.goType)
+	case parquetMap:
+		if err := t.elem.build(); err != nil {
+			return err
+		}
+		base = reflect.MapOf(reflect.TypeOf(""), t.elem.goType)
+	default:
+		switch t.physical {
+		case parquetBoolean:
+			base = reflect.TypeOf(false)
+		case parquetInt32:
+			base = reflect.TypeOf(int32(0))
+		case parquetInt64:
+			base = reflect.TypeOf(int64(0))
+		case parquetFloat:
+			base = reflect.TypeOf(float32(0))
+		case parquetDouble:
+			base = reflect.TypeOf(float64(0))
+		default:
+			base = reflect.TypeOf("")
+		}
+	}
+	t.goType = base
+	if t.optional {
+		t.goType = reflect.PointerTo(base)
+	}
+	return nil
+}
+
+// value converts v to the Go type of the column, path is the name of the
+// column used in errors.
+func (t *parquetType) value(path string, v any) (reflect.Value, error) {
+	if v == nil {
+		if !t.optional {
+			return reflect.Value{}, fmt.Errorf("field %q is required", path)
+		}
+		return reflect.Zero(t.goType), nil
+	}
+	v = t.unwrapUnion(v)
+
+	base := t.goType
+	if t.optional {
+		base = base.Elem()
+	}
+	rv := reflect.New(base).Elem()
+
+	switch t.kind {
+	case parquetGroup:
+		fields, ok := asFields(v)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("field %q: can't write %T as a group", path, v)
+		}
+		for i, f := range t.fields {
+			fv, err := f.typ.value(path+"."+f.name, fields[f.name])
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			rv.Field(i).Set(fv)
+		}
+	case parquetList:
+		list := reflect.ValueOf(v)
+		if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+			return reflect.Value{}, fmt.Errorf("field %q: can't write %T as a list", path, v)
+		}
+		rv.Set(reflect.MakeSlice(base, list.Len(), list.Len()))
+		for i := 0; i < list.Len(); i++ {
+			ev, err := t.elem.value(fmt.Sprintf("%s[%d]", path, i), list.Index(i).Interface())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			rv.Index(i).Set(ev)
+		}
+	case parquetMap:
+		m := reflect.ValueOf(v)
+		if m.Kind() != reflect.Map || m.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, fmt.Errorf("field %q: can't write %T as a map", path, v)
+		}
+		rv.Set(reflect.MakeMapWithSize(base, m.Len()))
+		iter := m.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			ev, err := t.elem.value(path+"."+key, iter.Value().Interface())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			rv.SetMapIndex(reflect.ValueOf(key), ev)
+		}
+	default:
+		pv, err := t.primitive(v)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("field %q: %w", path, err)
+		}
+		rv.Set(reflect.ValueOf(pv))
+	}
+
+	if !t.optional {
+		return rv, nil
+	}
+	return rv.Addr(), nil
+}
+
+// unwrapUnion returns the value of a nullable Avro union decoded into a map
+// with the name of its type as key, or v if it isn't wrapped.
+func (t *parquetType) unwrapUnion(v any) any {
+	if u, ok := v.(map[string]any); ok && t.union != "" && len(u) == 1 {
+		if uv, ok := u[t.union]; ok {
+			return uv
+		}
+	}
+	return v
+}
+
+// primitive converts v to the Go type of a primitive column.
+func (t *parquetType) primitive(v any) (any, error) {
+	if t.converted == parquetJSON {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	if pv, ok := t.logical(v); ok {
+		return pv, nil
+	}
+	if pv, ok := t.physicalValue(v); ok {
+		return pv, nil
+	}
+	return nil, fmt.Errorf("can't write %T as %s", v, t)
+}
+
+// logical converts values of logical types, e.g. times, ok is false if v is
+// not a value of the column's logical type.
+func (t *parquetType) logical(v any) (any, bool) {
+	if r, ok := v.(*big.Rat); ok && t.converted == parquetDecimal {
+		return t.unscaled(r)
+	}
+
+	switch v := v.(type) {
+	case time.Time:
+		switch t.converted {
+		case parquetTimestampMillis:
+			return v.UnixMilli(), true
+		case parquetTimestampMicros:
+			return v.UnixMicro(), true
+		case parquetDate:
+			// days since the epoch, rounded down for dates before 1970
+			return int32(math.Floor(float64(v.Unix()) / (24 * 60 * 60))), true
+		}
+	case time.Duration:
+		switch t.converted {
+		case parquetTimeMillis:
+			return int32(v.Milliseconds()), true //nolint:gosec // times of day fit in an int32
+		case parquetTimeMicros:
+			return v.Microseconds(), true
+		}
+	}
+	return nil, false
+}
+
+// unscaled converts a decimal to its unscaled integer, rounded to the scale of
+// the column, ok is false if it doesn't fit into an INT64 column. Decimals
+// written as byte arrays are big-endian two's complement integers, like Avro's
+// decimals.
+func (t *parquetType) unscaled(r *big.Rat) (any, bool) {
+	n, _ := new(big.Int).SetString(strings.Replace(r.FloatString(t.scale), ".", "", 1), 10)
+	if t.physical == parquetInt64 {
+		return n.Int64(), n.IsInt64()
+	}
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return string(b), true
+	}
+	// the two's complement of a negative number is 2^(8*size) + n, with a
+	// size that leaves the sign bit set
+	size := new(big.Int).Not(n).BitLen()/8 + 1
+	return string(new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(size*8)), n).Bytes()), true //nolint:gosec // size is positive
+}
+
+// physicalValue converts v to the physical type of the column, ok is false if
+// v can't be converted.
+func (t *parquetType) physicalValue(v any) (any, bool) {
+	switch t.physical {
+	case parquetBoolean:
+		b, ok := v.(bool)
+		return b, ok
+	case parquetInt32:
+		i, ok := asInt(v)
+		if !ok || i < math.MinInt32 || i > math.MaxInt32 {
+			return nil, false
+		}
+		return int32(i), true
+	case parquetInt64:
+		return asInt(v)
+	case parquetFloat:
+		f, ok := asFloat(v)
+		return float32(f), ok
+	case parquetDouble:
+		return asFloat(v)
+	}
+
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		// fixed size Avro values
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return string(b), true
+	}
+	return nil, false
+}
+
+func asFields(v any) (map[string]any, bool) {
+	switch f := v.(type) {
+	case map[string]any:
+		return f, true
+	case opencdc.StructuredData:
+		return f, true
+	default:
+		return nil, false
+	}
+}
+
+func asInt(v any) (int64, bool) {
+	switch i := v.(type) {
+	case json.Number:
+		n, err := i.Int64()
+		return n, err == nil
+	case float64:
+		return int64(i), i == math.Trunc(i)
+	case float32:
+		return int64(i), float64(i) == math.Trunc(float64(i))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), rv.Uint() <= math.MaxInt64 //nolint:gosec // checked
+	default:
+		return 0, false
+	}
+}
+
+func asFloat(v any) (float64, bool) {
+	switch f := v.(type) {
+	case json.Number:
+		n, err := f.Float64()
+		return n, err == nil
+	case float64:
+		return f, true
+	case float32:
+		return float64(f), true
+	}
+	if i, ok := asInt(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// inferParquetType infers the column type of a payload value, all inferred
+// columns are optional. Fields that are nil are left out, as their type is
+// unknown.
+func inferParquetType(v any) *parquetType {
+	var t *parquetType
+	switch v := v.(type) {
+	case bool:
+		t = parquetPrimitiveType(parquetBoolean, "")
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			t = parquetPrimitiveType(parquetInt64, "")
+		} else {
+			t = parquetPrimitiveType(parquetDouble, "")
+		}
+	case float32, float64:
+		t = parquetPrimitiveType(parquetDouble, "")
+	case string:
+		t = parquetPrimitiveType(parquetByteArray, parquetUTF8)
+	case []byte:
+		t = parquetPrimitiveType(parquetByteArray, "")
+	case time.Time:
+		t = parquetPrimitiveType(parquetInt64, parquetTimestampMicros)
+	case map[string]any:
+		t = inferParquetGroup(v)
+	case opencdc.StructuredData:
+		t = inferParquetGroup(v)
+	default:
+		if _, ok := asInt(v); ok {
+			t = parquetPrimitiveType(parquetInt64, "")
+		} else if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+			t = inferParquetList(rv)
+		} else {
+			t = parquetJSONType()
+		}
+	}
+	t.optional = true
+	return t
+}
+
+// inferParquetGroup infers the type of a group, its fields are sorted by name.
+func inferParquetGroup(fields map[string]any) *parquetType {
+	names := make([]string, 0, len(fields))
+	for name, v := range fields {
+		if v != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	t := &parquetType{kind: parquetGroup}
+	for _, name := range names {
+		t.fields = append(t.fields, parquetField{name: name, typ: inferParquetType(fields[name])})
+	}
+	return t
+}
+
+// inferParquetList infers the type of a list from its elements, lists of
+// lists and lists with elements of conflicting types are written as JSON. The
+// element type of empty lists is unknown.
+func inferParquetList(list reflect.Value) *parquetType {
+	var elem *parquetType
+	for i := 0; i < list.Len(); i++ {
+		v := list.Index(i).Interface()
+		if v == nil {
+			continue
+		}
+		t := inferParquetType(v)
+		if t.kind == parquetList || t.kind == parquetMap {
+			return parquetJSONType()
+		}
+		var ok bool
+		if elem, ok = mergeParquetTypes(elem, t); !ok {
+			return parquetJSONType()
+		}
+	}
+	return &parquetType{kind: parquetList, elem: elem}
+}
+
+// mergeParquetTypes returns a type that can hold the values of both inferred
+// types, ok is false if the types conflict. Groups contain the fields of both
+// groups, integers are widened to doubles. A nil type is unknown and merges
+// with any type.
+func mergeParquetTypes(a, b *parquetType) (*parquetType, bool) {
+	if a == nil {
+		return b, true
+	}
+	if b == nil {
+		return a, true
+	}
+	if a.kind != b.kind {
+		return nil, false
+	}
+
+	merged := &parquetType{kind: a.kind, optional: a.optional || b.optional}
+	switch a.kind {
+	case parquetGroup:
+		types := make(map[string]*parquetType, len(a.fields)+len(b.fields))
+		for _, f := range a.fields {
+			types[f.name] = f.typ
+		}
+		for _, f := range b.fields {
+			t, ok := mergeParquetTypes(types[f.name], f.typ)
+			if !ok {
+				return nil, false
+			}
+			types[f.name] = t
+		}
+		names := make([]string, 0, len(types))
+		for name := range types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			merged.fields = append(merged.fields, parquetField{name: name, typ: types[name]})
+		}
+	case parquetList, parquetMap:
+		elem, ok := mergeParquetTypes(a.elem, b.elem)
+		if !ok {
+			return nil, false
+		}
+		merged.elem = elem
+	default:
+		switch {
+		case a.physical == b.physical && a.converted == b.converted:
+			merged.physical, merged.converted = a.physical, a.converted
+		case isParquetNumber(a) && isParquetNumber(b):
+			merged.physical = parquetDouble
+		default:
+			return nil, false
+		}
+	}
+	return merged, true
+}
+
+func isParquetNumber(t *parquetType) bool {
+	return t.converted == "" && (t.physical == parquetInt64 || t.physical == parquetDouble)
+}
+
+// avroParquetType converts an Avro schema into a column type, Avro values
+// that have no Parquet equivalent (e.g. unions of several types) are written
+// as JSON.
+func avroParquetType(s avro.Schema) *parquetType {
+	switch s := s.(type) {
+	case *avro.RecordSchema:
+		if len(s.Fields()) == 0 {
+			return parquetJSONType()
+		}
+		t := &parquetType{kind: parquetGroup}
+		for _, f := range s.Fields() {
+			t.fields = append(t.fields, parquetField{name: f.Name(), typ: avroParquetType(f.Type())})
+		}
+		return t
+	case *avro.UnionSchema:
+		if !s.Nullable() || len(s.Types()) != 2 {
+			t := parquetJSONType()
+			t.optional = true
+			return t
+		}
+		_, i := s.Indices()
+		t := avroParquetType(s.Types()[i])
+		t.optional = true
+		t.union = avroTypeName(s.Types()[i])
+		return t
+	case *avro.ArraySchema:
+		elem := avroParquetType(s.Items())
+		if elem.kind == parquetList || elem.kind == parquetMap {
+			elem = parquetJSONType()
+		}
+		return &parquetType{kind: parquetList, elem: elem}
+	case *avro.MapSchema:
+		elem := avroParquetType(s.Values())
+		if elem.kind != parquetPrimitive {
+			elem = parquetJSONType()
+		}
+		return &parquetType{kind: parquetMap, elem: elem}
+	case *avro.EnumSchema:
+		return parquetPrimitiveType(parquetByteArray, parquetUTF8)
+	case *avro.FixedSchema:
+		return avroLogicalParquetType(s.Logical(), parquetPrimitiveType(parquetByteArray, ""))
+	case *avro.PrimitiveSchema:
+		return avroLogicalParquetType(s.Logical(), avroPrimitiveParquetType(s.Type()))
+	default:
+		return parquetJSONType()
+	}
+}
+
+// avroTypeName returns the name Avro uses for a type in a union, the full
+// name of named types, or the type followed by its logical type.
+func avroTypeName(s avro.Schema) string {
+	if ref, ok := s.(*avro.RefSchema); ok {
+		s = ref.Schema()
+	}
+	if n, ok := s.(avro.NamedSchema); ok {
+		return n.FullName()
+	}
+	name := string(s.Type())
+	if l, ok := s.(avro.LogicalTypeSchema); ok && l.Logical() != nil {
+		name += "." + string(l.Logical().Type())
+	}
+	return name
+}
+
+func avroPrimitiveParquetType(t avro.Type) *parquetType {
+	switch t {
+	case avro.Boolean:
+		return parquetPrimitiveType(parquetBoolean, "")
+	case avro.Int:
+		return parquetPrimitiveType(parquetInt32, "")
+	case avro.Long:
+		return parquetPrimitiveType(parquetInt64, "")
+	case avro.Float:
+		return parquetPrimitiveType(parquetFloat, "")
+	case avro.Double:
+		return parquetPrimitiveType(parquetDouble, "")
+	case avro.String:
+		return parquetPrimitiveType(parquetByteArray, parquetUTF8)
+	case avro.Bytes:
+		return parquetPrimitiveType(parquetByteArray, "")
+	default:
+		return parquetJSONType()
+	}
+}
+
+// avroLogicalParquetType returns the column type of an Avro logical type, or
+// t if the logical type has no Parquet equivalent.
+func avroLogicalParquetType(l avro.LogicalSchema, t *parquetType) *parquetType {
+	if l == nil {
+		return t
+	}
+	switch l.Type() {
+	case avro.TimestampMillis, avro.LocalTimestampMillis:
+		return parquetPrimitiveType(parquetInt64, parquetTimestampMillis)
+	case avro.TimestampMicros, avro.LocalTimestampMicros:
+		return parquetPrimitiveType(parquetInt64, parquetTimestampMicros)
+	case avro.Date:
+		return parquetPrimitiveType(parquetInt32, parquetDate)
+	case avro.TimeMillis:
+		return parquetPrimitiveType(parquetInt32, parquetTimeMillis)
+	case avro.TimeMicros:
+		return parquetPrimitiveType(parquetInt64, parquetTimeMicros)
+	case avro.UUID:
+		return parquetPrimitiveType(parquetByteArray, parquetUTF8)
+	case avro.Decimal:
+		d, ok := l.(*avro.DecimalLogicalSchema)
+		if !ok {
+			return t
+		}
+		dt := parquetPrimitiveType(parquetByteArray, parquetDecimal)
+		if d.Precision() <= maxParquetInt64Precision {
+			dt.physical = parquetInt64
+		}
+		dt.precision = d.Precision()
+		dt.scale = d.Scale()
+		return dt
+	default:
+		return t
+	}
+}
+
+// typedPayload returns the payload of the record that is written to typed
+// columns, the payload after the change, or before the change for deletes.
+// Raw payloads are decoded with the schema if the record has one, otherwise
+// they need to contain a JSON object.
+func typedPayload(s *avro.RecordSchema, r opencdc.Record) (map[string]any, error) {
+	payload := r.Payload.After
+	if payload == nil {
+		payload = r.Payload.Before
+	}
+	if raw, ok := payload.(opencdc.RawData); ok && s != nil && len(raw) > 0 {
+		var fields map[string]any
+		if err := avro.Unmarshal(s, raw, &fields); err != nil {
+			return nil, fmt.Errorf("could not decode payload of record %q with its schema: %w", r.Position, err)
+		}
+		return fields, nil
+	}
+	return payloadFields(r)
+}
+
+// inferPayloadType infers the type of the record's payload, it returns nil
+// if the payload can't be parsed.
+func inferPayloadType(r opencdc.Record) *parquetType {
+	fields, err := payloadFields(r)
+	if err != nil {
+		// the error is returned when the record is written
+		return nil
+	}
+	return inferParquetGroup(fields)
+}
+
+// splitTypedParquet splits the records into groups written to the same file.
+// Records with a payload schema are grouped by schema, the inferred types of
+// records without a schema are merged until a type conflicts, e.g. a field
+// changes from a string to a number.
+func splitTypedParquet(records []opencdc.Record) [][]opencdc.Record {
+	var groups [][]opencdc.Record
+	start := 0
+	// columns are the merged types of the current group of records without a
+	// payload schema
+	var columns *parquetType
+	for i, r := range records {
+		id := payloadSchemaID(r)
+		var t *parquetType
+		if id == "" {
+			t = inferPayloadType(r)
+		}
+		if i > start {
+			same := id == payloadSchemaID(records[start])
+			if same && id == "" {
+				var merged *parquetType
+				if merged, same = mergeParquetTypes(columns, t); same {
+					t = merged
+				}
+			}
+			if !same {
+				groups = append(groups, records[start:i])
+				start = i
+			}
+		}
+		columns = t
+	}
+	return append(groups, records[start:])
+}
+
+// typedPayloadType returns the type of the payload columns, derived from the
+// payload schema s of the records, or inferred from their payloads if s is
+// nil.
+func typedPayloadType(s *avro.RecordSchema, records []opencdc.Record) (*parquetType, error) {
+	var t *parquetType
+	if s != nil {
+		t = avroParquetType(s)
+	}
+	first := records[0]
+	for _, r := range records {
+		if payloadSchemaID(r) != payloadSchemaID(first) {
+			return nil, fmt.Errorf("record %q has payload schema %q, expected %q", r.Position, payloadSchemaID(r), payloadSchemaID(first))
+		}
+		if s != nil {
+			continue
+		}
+		fields, err := payloadFields(r)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		t, ok = mergeParquetTypes(t, inferParquetGroup(fields))
+		if !ok {
+			return nil, fmt.Errorf("payload of record %q has types that conflict with the previous records", r.Position)
+		}
+	}
+
+	t.optional = true
+	if t.kind == parquetGroup && len(t.fields) > 0 {
+		if err := t.build(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// typedParquetRecord returns the type of the rows of a typed Parquet file,
+// the fields of parquetRecord with the payload as a group of columns. The
+// payload is left out if it has no columns.
+func typedParquetRecord(payload *parquetType) reflect.Type {
+	fields := []reflect.StructField{
+		{Name: "Operation", Type: reflect.TypeOf(""), Tag: `parquet:"name=operation, type=BYTE_ARRAY"`},
+		{Name: "Position", Type: reflect.TypeOf(""), Tag: `parquet:"name=position, type=BYTE_ARRAY"`},
+		{Name: "Key", Type: reflect.TypeOf(""), Tag: `parquet:"name=key, type=BYTE_ARRAY"`},
+		{Name: "Metadata", Type: reflect.TypeOf(map[string]string{}), Tag: `parquet:"name=metadata, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`},
+	}
+	if payload.kind == parquetGroup && len(payload.fields) > 0 {
+		fields = append(fields, reflect.StructField{
+			Name: "Payload",
+			Type: payload.goType,
+			Tag:  `parquet:"name=payload"`,
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// makeTypedParquetBytes writes the records with their payloads as typed
+// columns, the columns are derived from the payload schema of the records, or
+// inferred from their payloads. All records need to have the same schema, and
+// the inferred types of their payloads can't conflict (see Split).
+func makeTypedParquetBytes(ctx context.Context, records []opencdc.Record) ([]byte, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+	first := records[0]
+	s, err := payloadSchema(ctx, first)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadType, err := typedPayloadType(s, records)
+	if err != nil {
+		return nil, err
+	}
+	rowType := typedParquetRecord(payloadType)
+
+	var buf bytes.Buffer
+	pw, err := writer.NewParquetWriterFromWriter(&buf, reflect.New(rowType).Interface(), int64(len(records)))
+	if err != nil {
+		return nil, err
+	}
+	pw.CompressionType = parquet.CompressionCodec_GZIP
+
+	for _, r := range records {
+		row := reflect.New(rowType).Elem()
+		row.Field(0).SetString(r.Operation.String())
+		row.Field(1).SetString(string(r.Position))
+		row.Field(2).SetString(string(dataBytes(r.Key)))
+		row.Field(3).Set(reflect.ValueOf(map[string]string(r.Metadata)))
+		if rowType.NumField() > 4 {
+			fields, err := typedPayload(s, r)
+			if err != nil {
+				return nil, err
+			}
+			var v any
+			if fields != nil {
+				v = fields
+			}
+			pv, err := payloadType.value("payload", v)
+			if err != nil {
+				return nil, fmt.Errorf("could not write payload of record %q: %w", r.Position, err)
+			}
+			row.Field(4).Set(pv)
+		}
+
+		if err = pw.Write(row.Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = pw.WriteStop(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
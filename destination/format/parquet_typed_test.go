@@ -0,0 +1,276 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-sdk/schema"
+	"github.com/hamba/avro/v2"
+	"github.com/matryer/is"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestMakeTypedParquetBytes_Inferred(t *testing.T) {
+	is := is.New(t)
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	records := []opencdc.Record{
+		{
+			Operation: opencdc.OperationCreate,
+			Position:  opencdc.Position("1"),
+			Key:       opencdc.RawData("key-1"),
+			Metadata:  opencdc.Metadata{"foo": "bar"},
+			Payload: opencdc.Change{After: opencdc.StructuredData{
+				"id":        1,
+				"amount":    12.5,
+				"createdAt": createdAt,
+				"customer":  map[string]any{"name": "Jane"},
+				"tags":      []string{"a", "b"},
+				"items":     []any{map[string]any{"sku": "x"}},
+			}},
+		},
+		{
+			Operation: opencdc.OperationUpdate,
+			Position:  opencdc.Position("2"),
+			Key:       opencdc.RawData("key-2"),
+			Metadata:  opencdc.Metadata{},
+			Payload:   opencdc.Change{After: opencdc.RawData(`{"id":2,"amount":3.25,"createdAt":null,"customer":{"name":"John"},"tags":["c"],"items":[{"sku":"y"}]}`)},
+		},
+	}
+
+	data, err := Parquet.MakeBytes(context.Background(), records, Options{Parquet: ParquetOptions{Typed: true}})
+	is.NoErr(err)
+
+	is.Equal(parquetColumns(t, data), []string{
+		"parquet_go_root",
+		"operation:BYTE_ARRAY", "position:BYTE_ARRAY", "key:BYTE_ARRAY",
+		"metadata", "key_value", "key:BYTE_ARRAY:UTF8", "value:BYTE_ARRAY:UTF8",
+		"payload",
+		"amount:DOUBLE",
+		"createdAt:INT64:TIMESTAMP_MICROS",
+		"customer", "name:BYTE_ARRAY:UTF8",
+		"id:INT64",
+		"items", "list", "element", "sku:BYTE_ARRAY:UTF8",
+		"tags", "list", "element:BYTE_ARRAY:UTF8",
+	})
+	is.Equal(parquetRows(t, data), []string{
+		`{"Operation":"create","Position":"1","Key":"key-1","Metadata":{"foo":"bar"},"Payload":{"Amount":12.5,"CreatedAt":1714979289123456,"Customer":{"Name":"Jane"},"Id":1,"Items":[{"Sku":"x"}],"Tags":["a","b"]}}`,
+		`{"Operation":"update","Position":"2","Key":"key-2","Metadata":{},"Payload":{"Amount":3.25,"CreatedAt":null,"Customer":{"Name":"John"},"Id":2,"Items":[{"Sku":"y"}],"Tags":["c"]}}`,
+	})
+}
+
+func TestMakeTypedParquetBytes_Schema(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	s, err := schema.Create(ctx, schema.TypeAvro, "payments", []byte(`{
+		"type": "record", "name": "payment", "fields": [
+			{"name": "id", "type": "long"},
+			{"name": "amount", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+			{"name": "paidAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+			{"name": "status", "type": {"type": "enum", "name": "status", "symbols": ["OK", "FAILED"]}},
+			{"name": "payer", "type": ["null", {"type": "record", "name": "payer", "fields": [
+				{"name": "name", "type": "string"}
+			]}]},
+			{"name": "labels", "type": {"type": "map", "values": "int"}}
+		]}`))
+	is.NoErr(err)
+	parsed, err := avro.Parse(string(s.Bytes))
+	is.NoErr(err)
+
+	paidAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	raw, err := avro.Marshal(parsed, map[string]any{
+		"id":     int64(2),
+		"amount": big.NewRat(1, 4),
+		"paidAt": paidAt,
+		"status": "FAILED",
+		"payer":  nil,
+		"labels": map[string]any{},
+	})
+	is.NoErr(err)
+	// non-null union values are decoded into a map with the type name as key
+	rawPayer, err := avro.Marshal(parsed, map[string]any{
+		"id":     int64(3),
+		"amount": big.NewRat(-5, 1),
+		"paidAt": paidAt,
+		"status": "OK",
+		"payer":  map[string]any{"payer": map[string]any{"name": "Joe"}},
+		"labels": map[string]any{"b": 2},
+	})
+	is.NoErr(err)
+
+	records := []opencdc.Record{
+		schemaRecord("1", s, opencdc.Change{After: opencdc.StructuredData{
+			"id":     int64(1),
+			"amount": big.NewRat(1999, 100),
+			"paidAt": paidAt,
+			"status": "OK",
+			"payer":  map[string]any{"name": "Jane"},
+			"labels": map[string]any{"a": 1},
+		}}),
+		schemaRecord("2", s, opencdc.Change{After: opencdc.RawData(raw)}),
+		schemaRecord("3", s, opencdc.Change{After: opencdc.RawData(rawPayer)}),
+	}
+
+	data, err := Parquet.MakeBytes(ctx, records, Options{Parquet: ParquetOptions{Typed: true}})
+	is.NoErr(err)
+
+	is.Equal(parquetColumns(t, data)[8:], []string{
+		"payload",
+		"id:INT64",
+		"amount:INT64:DECIMAL",
+		"paidAt:INT64:TIMESTAMP_MILLIS",
+		"status:BYTE_ARRAY:UTF8",
+		"payer", "name:BYTE_ARRAY:UTF8",
+		"labels", "key_value", "key:BYTE_ARRAY:UTF8", "value:INT32",
+	})
+	is.Equal(parquetRows(t, data), []string{
+		`{"Operation":"create","Position":"1","Key":"","Metadata":{"opencdc.payload.schema.subject":"payments","opencdc.payload.schema.version":"1"},"Payload":{"Id":1,"Amount":1999,"PaidAt":1714979289000,"Status":"OK","Payer":{"Name":"Jane"},"Labels":{"a":1}}}`,
+		`{"Operation":"create","Position":"2","Key":"","Metadata":{"opencdc.payload.schema.subject":"payments","opencdc.payload.schema.version":"1"},"Payload":{"Id":2,"Amount":25,"PaidAt":1714979289000,"Status":"FAILED","Payer":null,"Labels":{}}}`,
+		`{"Operation":"create","Position":"3","Key":"","Metadata":{"opencdc.payload.schema.subject":"payments","opencdc.payload.schema.version":"1"},"Payload":{"Id":3,"Amount":-500,"PaidAt":1714979289000,"Status":"OK","Payer":{"Name":"Joe"},"Labels":{"b":2}}}`,
+	})
+}
+
+func TestParquetType_Date(t *testing.T) {
+	is := is.New(t)
+	date := parquetPrimitiveType(parquetInt32, parquetDate)
+
+	for _, tc := range []struct {
+		time time.Time
+		want int32
+	}{
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(1970, 1, 2, 12, 0, 0, 0, time.UTC), 1},
+		{time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), -1},
+		{time.Date(1969, 12, 31, 12, 0, 0, 0, time.UTC), -1},
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), -25567},
+	} {
+		v, ok := date.logical(tc.time)
+		is.True(ok)
+		is.Equal(v, tc.want) // tc.time
+	}
+}
+
+func TestParquetType_Decimal(t *testing.T) {
+	is := is.New(t)
+	small := avroParquetType(avro.NewPrimitiveSchema(avro.Bytes, avro.NewDecimalLogicalSchema(18, 2)))
+	large := avroParquetType(avro.NewPrimitiveSchema(avro.Bytes, avro.NewDecimalLogicalSchema(19, 2)))
+	is.Equal(small.tag("a"), "name=a, type=INT64, convertedtype=DECIMAL, precision=18, scale=2")
+	is.Equal(large.tag("a"), "name=a, type=BYTE_ARRAY, convertedtype=DECIMAL, precision=19, scale=2")
+
+	for _, tc := range []struct {
+		rat   *big.Rat
+		small any
+		large any
+	}{
+		{big.NewRat(1999, 100), int64(1999), "\x07\xcf"},
+		{big.NewRat(1, 1000), int64(0), "\x00"},
+		{big.NewRat(128, 100), int64(128), "\x00\x80"},
+		{big.NewRat(-1, 100), int64(-1), "\xff"},
+		{big.NewRat(-128, 100), int64(-128), "\x80"},
+		{big.NewRat(-129, 100), int64(-129), "\xff\x7f"},
+	} {
+		v, ok := small.logical(tc.rat)
+		is.True(ok)
+		is.Equal(v, tc.small) // tc.rat
+		v, ok = large.logical(tc.rat)
+		is.True(ok)
+		is.Equal(v, tc.large) // tc.rat
+	}
+
+	// the unscaled value doesn't fit into an INT64
+	_, ok := small.logical(new(big.Rat).SetFrac(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1)))
+	is.True(!ok)
+}
+
+func TestFormat_SplitTypedParquet(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	s, err := schema.Create(ctx, schema.TypeAvro, "split-parquet", []byte(`{"type":"record","name":"r","fields":[{"name":"a","type":"long"}]}`))
+	is.NoErr(err)
+
+	record := func(position string, payload opencdc.Data) opencdc.Record {
+		return opencdc.Record{
+			Position: opencdc.Position(position),
+			Metadata: opencdc.Metadata{},
+			Payload:  opencdc.Change{After: payload},
+		}
+	}
+	records := []opencdc.Record{
+		record("1", opencdc.StructuredData{"a": 1, "b": "x"}),
+		// missing fields, nulls, empty lists and wider numbers are merged
+		record("2", opencdc.StructuredData{"a": 1.5, "b": nil, "c": []any{}}),
+		record("3", opencdc.RawData(`{"c":["y"]}`)),
+		// the type of b changes
+		record("4", opencdc.StructuredData{"b": 2}),
+		schemaRecord("5", s, opencdc.Change{After: opencdc.StructuredData{"a": int64(1)}}),
+		schemaRecord("6", s, opencdc.Change{After: opencdc.StructuredData{"a": int64(2)}}),
+		record("7", opencdc.StructuredData{"b": 3}),
+	}
+	opts := Options{Parquet: ParquetOptions{Typed: true}}
+
+	groups := Parquet.Split(records, opts)
+	is.Equal(groups, [][]opencdc.Record{records[:3], records[3:4], records[4:6], records[6:]})
+	is.Equal(Parquet.Split(records, Options{}), [][]opencdc.Record{records})
+
+	for _, g := range groups {
+		_, err := Parquet.MakeBytes(ctx, g, opts)
+		is.NoErr(err)
+	}
+	_, err = Parquet.MakeBytes(ctx, records[:4], opts)
+	is.True(err != nil) // conflicting types
+}
+
+func parquetColumns(t *testing.T, data []byte) []string {
+	is := is.New(t)
+	pr, err := reader.NewParquetReader(NewParquetBuffer(data), nil, 1)
+	is.NoErr(err)
+	defer pr.ReadStop()
+
+	var columns []string
+	for i, e := range pr.SchemaHandler.SchemaElements {
+		c := pr.SchemaHandler.Infos[i].ExName
+		if e.Type != nil {
+			c += ":" + e.Type.String()
+		}
+		if e.ConvertedType != nil && e.Type != nil {
+			c += ":" + e.ConvertedType.String()
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+func parquetRows(t *testing.T, data []byte) []string {
+	is := is.New(t)
+	pr, err := reader.NewParquetReader(NewParquetBuffer(data), nil, 1)
+	is.NoErr(err)
+	defer pr.ReadStop()
+
+	rows, err := pr.ReadByNumber(int(pr.GetNumRows()))
+	is.NoErr(err)
+	var got []string
+	for _, row := range rows {
+		b, err := json.Marshal(row)
+		is.NoErr(err)
+		got = append(got, string(b))
+	}
+	return got
+}
@@ -0,0 +1,100 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// Reader decodes the records contained in a file written by MakeBytes.
+type Reader interface {
+	// Next returns the next record, or io.EOF if there are no more records.
+	// Only the operation, position, key, payload and metadata are restored,
+	// the payload is returned as raw data.
+	Next() (opencdc.Record, error)
+}
+
+// NewReader returns a Reader decoding the records in data, data needs to be
+// written in the given format. CSV and Avro files can't be read, they only
+// contain the payloads.
+func (f Format) NewReader(data io.Reader) (Reader, error) {
+	switch f {
+	case Parquet:
+		return newParquetReader(data)
+	case JSON:
+		return newJSONReader(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", f)
+	}
+}
+
+// makeRecord restores a record from the fields written for each record.
+func makeRecord(operation, position, payload, key string, metadata map[string]string) (opencdc.Record, error) {
+	var op opencdc.Operation
+	if err := op.UnmarshalText([]byte(operation)); err != nil {
+		return opencdc.Record{}, err
+	}
+
+	r := opencdc.Record{
+		Operation: op,
+		Position:  opencdc.Position(position),
+		Key:       opencdc.RawData(key),
+		Metadata:  metadata,
+	}
+	if r.Metadata == nil {
+		r.Metadata = opencdc.Metadata{}
+	}
+	// only the payload after the change is written, deletes don't have one
+	if op != opencdc.OperationDelete {
+		r.Payload.After = opencdc.RawData(payload)
+	}
+	return r, nil
+}
+
+// ParquetBuffer is a read-only source.ParquetFile backed by a byte slice.
+type ParquetBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+var _ source.ParquetFile = (*ParquetBuffer)(nil)
+
+// NewParquetBuffer returns a ParquetBuffer used to read the Parquet file
+// contained in data.
+func NewParquetBuffer(data []byte) *ParquetBuffer {
+	return &ParquetBuffer{Reader: bytes.NewReader(data), data: data}
+}
+
+func (b *ParquetBuffer) Open(string) (source.ParquetFile, error) {
+	return NewParquetBuffer(b.data), nil
+}
+
+func (b *ParquetBuffer) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet buffer is read-only")
+}
+
+func (b *ParquetBuffer) Write([]byte) (int, error) {
+	return 0, errors.New("parquet buffer is read-only")
+}
+
+func (b *ParquetBuffer) Close() error {
+	return nil
+}
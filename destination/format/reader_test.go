@@ -0,0 +1,83 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func TestReader_RoundTrip(t *testing.T) {
+	records := []opencdc.Record{
+		{
+			Operation: opencdc.OperationCreate,
+			Position:  opencdc.Position("1"),
+			Key:       opencdc.RawData("key-1"),
+			Metadata:  opencdc.Metadata{"foo": "bar"},
+			Payload:   opencdc.Change{After: opencdc.RawData(`{"id":1}`)},
+		},
+		{
+			Operation: opencdc.OperationUpdate,
+			Position:  opencdc.Position("2"),
+			Key:       opencdc.RawData("key-1"),
+			Metadata:  opencdc.Metadata{},
+			Payload:   opencdc.Change{After: opencdc.RawData(`{"id":2}`)},
+		},
+		{
+			Operation: opencdc.OperationDelete,
+			Position:  opencdc.Position("3"),
+			Key:       opencdc.RawData("key-1"),
+			Metadata:  opencdc.Metadata{"foo": "baz"},
+		},
+	}
+
+	// CSV files contain the flattened payloads, records can't be restored
+	for _, f := range []Format{Parquet, JSON} {
+		t.Run(string(f), func(t *testing.T) {
+			is := is.New(t)
+			data, err := f.MakeBytes(context.Background(), records, Options{})
+			is.NoErr(err)
+
+			r, err := f.NewReader(bytes.NewReader(data))
+			is.NoErr(err)
+
+			var got []opencdc.Record
+			for {
+				rec, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				is.NoErr(err)
+				got = append(got, rec)
+			}
+			is.Equal(got, records)
+		})
+	}
+}
+
+func TestReader_InvalidOperation(t *testing.T) {
+	is := is.New(t)
+	r, err := JSON.NewReader(bytes.NewReader([]byte(`{"Operation":"foo","Key":"key-1"}`)))
+	is.NoErr(err)
+
+	_, err = r.Next()
+	is.True(err != nil)
+}
@@ -0,0 +1,65 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-sdk/schema"
+	"github.com/hamba/avro/v2"
+)
+
+// payloadSchemaID returns the subject and version of the record's payload
+// schema, or an empty string if the record has no payload schema.
+func payloadSchemaID(r opencdc.Record) string {
+	subject := r.Metadata[opencdc.MetadataPayloadSchemaSubject]
+	if subject == "" {
+		return ""
+	}
+	return subject + ":" + r.Metadata[opencdc.MetadataPayloadSchemaVersion]
+}
+
+// payloadSchema fetches the Avro schema of the record's payload from the
+// schema service, it returns nil if the record has no payload schema.
+func payloadSchema(ctx context.Context, r opencdc.Record) (*avro.RecordSchema, error) {
+	subject, err := r.Metadata.GetPayloadSchemaSubject()
+	if errors.Is(err, opencdc.ErrMetadataFieldNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	version, err := r.Metadata.GetPayloadSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("could not get payload schema version of record %q: %w", r.Position, err)
+	}
+
+	s, err := schema.Get(ctx, subject, version)
+	if err != nil {
+		return nil, fmt.Errorf("could not get payload schema %s:%d: %w", subject, version, err)
+	}
+	parsed, err := avro.Parse(string(s.Bytes))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse payload schema %s:%d: %w", subject, version, err)
+	}
+	rs, ok := parsed.(*avro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("payload schema %s:%d is not a record schema", subject, version)
+	}
+	return rs, nil
+}
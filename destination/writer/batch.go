@@ -15,19 +15,34 @@
 package writer
 
 import (
+	"context"
+
 	"github.com/conduitio/conduit-commons/opencdc"
 	"github.com/conduitio/conduit-connector-s3/destination/format"
 )
 
 // Batch describes the data that needs to be saved by the Writer
 type Batch struct {
-	Format  format.Format
+	Format format.Format
+	// Options configures the format.
+	Options format.Options
 	Records []opencdc.Record
 }
 
 // Bytes returns a byte representation for the Writer to write into a file.
-func (b *Batch) Bytes() ([]byte, error) {
-	return b.Format.MakeBytes(b.Records)
+func (b *Batch) Bytes(ctx context.Context) ([]byte, error) {
+	return b.Format.MakeBytes(ctx, b.Records, b.Options)
+}
+
+// Split splits the batch into the batches that are written to separate
+// files, see format.Format.Split.
+func (b *Batch) Split() []*Batch {
+	groups := b.Format.Split(b.Records, b.Options)
+	batches := make([]*Batch, len(groups))
+	for i, records := range groups {
+		batches[i] = &Batch{Format: b.Format, Options: b.Options, Records: records}
+	}
+	return batches
 }
 
 // LastPosition returns the position of the last record in the batch.
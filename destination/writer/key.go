@@ -0,0 +1,222 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/google/uuid"
+)
+
+// uuidPlaceholder is rendered in place of .UUID, it is replaced with one UUID
+// per object once the records are grouped into objects.
+const uuidPlaceholder = "\x00uuid\x00"
+
+// KeyTemplate renders the keys of the objects written by the S3 writer.
+// Records of a batch with different keys are written to different objects,
+// so keys can partition records, e.g. by date or tenant.
+type KeyTemplate struct {
+	tmpl *template.Template
+}
+
+// ParseKeyTemplate parses a Go template rendering the key of an object. The
+// template is executed for each record with the following methods:
+//
+//   - .Key: the record's key
+//   - .Collection: the record's opencdc.collection metadata
+//   - .Operation: the record's operation, e.g. "create"
+//   - .Time "layout": the time the record was created (opencdc.createdAt),
+//     or read (opencdc.readAt) if the creation time is unknown, formatted
+//     with the Go time layout in UTC
+//   - .ReadAt "layout": the time the record was read (opencdc.readAt)
+//   - .Metadata "key": the value of a metadata key
+//   - .Field "path": a field of the payload, nested fields are separated by
+//     dots (e.g. "customer.id")
+//   - .UUID: a random UUID, the same for all records in an object
+//   - .Ext: the file extension of the format, e.g. "json"
+//
+// Slashes in metadata values and fields are escaped as "%2F", so they can't
+// add segments to the key, and percent signs as "%25", so escaped values don't
+// collide. Keys containing "." or ".." segments are rejected,
+// so objects can't be written outside of the key prefix.
+func ParseKeyTemplate(text string) (*KeyTemplate, error) {
+	tmpl, err := template.New("key").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key template: %w", err)
+	}
+	// methods that don't exist are only detected when the template is
+	// executed
+	if err := tmpl.Execute(io.Discard, keyData{}); err != nil {
+		return nil, fmt.Errorf("invalid key template: %w", err)
+	}
+	return &KeyTemplate{tmpl: tmpl}, nil
+}
+
+// Object contains the records of a batch written to a single object.
+type Object struct {
+	Key   string
+	Batch *Batch
+}
+
+// Objects groups the records of the batch by their rendered key, objects are
+// returned in the order their first record appears in the batch and keep the
+// order of their records.
+func (t *KeyTemplate) Objects(batch *Batch, now time.Time) ([]Object, error) {
+	var objects []Object
+	index := make(map[string]int)
+	for _, r := range batch.Records {
+		key, err := t.render(keyData{record: r, ext: batch.Format.Ext(), now: now})
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(objects)
+			index[key] = i
+			objects = append(objects, Object{Key: key, Batch: &Batch{Format: batch.Format, Options: batch.Options}})
+		}
+		objects[i].Batch.Records = append(objects[i].Batch.Records, r)
+	}
+	for i := range objects {
+		objects[i].Key = strings.ReplaceAll(objects[i].Key, uuidPlaceholder, uuid.NewString())
+	}
+	return objects, nil
+}
+
+// Render returns the key of the object the record is written to on its own.
+func (t *KeyTemplate) Render(r opencdc.Record, ext string, now time.Time) (string, error) {
+	key, err := t.render(keyData{record: r, ext: ext, now: now})
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(key, uuidPlaceholder, uuid.NewString()), nil
+}
+
+func (t *KeyTemplate) render(data keyData) (string, error) {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("could not render key for record %q: %w", data.record.Position, err)
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("key template rendered an empty key for record %q", data.record.Position)
+	}
+	key := sb.String()
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("key template rendered key %q containing %q for record %q", key, segment, data.record.Position)
+		}
+	}
+	return key, nil
+}
+
+// keyData is the data a key template is executed with.
+type keyData struct {
+	record opencdc.Record
+	ext    string
+	// now is used if the record doesn't contain the time it was read
+	now time.Time
+}
+
+func (d keyData) Key() string {
+	if d.record.Key == nil {
+		return ""
+	}
+	return string(d.record.Key.Bytes())
+}
+
+func (d keyData) Collection() string {
+	c, _ := d.record.Metadata.GetCollection()
+	return c
+}
+
+func (d keyData) Operation() string {
+	return d.record.Operation.String()
+}
+
+func (d keyData) Time(layout string) string {
+	if t, err := d.record.Metadata.GetCreatedAt(); err == nil {
+		return t.UTC().Format(layout)
+	}
+	return d.ReadAt(layout)
+}
+
+func (d keyData) ReadAt(layout string) string {
+	t, err := d.record.Metadata.GetReadAt()
+	if err != nil {
+		t = d.now
+	}
+	return t.UTC().Format(layout)
+}
+
+func (d keyData) Metadata(key string) string {
+	return escapeKeyValue(d.record.Metadata[key])
+}
+
+// Field returns a field of the payload after the change, or before the change
+// for deletes. Raw payloads are parsed as JSON. Missing fields are rendered
+// as an empty string.
+func (d keyData) Field(path string) string {
+	payload := d.record.Payload.After
+	if payload == nil {
+		payload = d.record.Payload.Before
+	}
+
+	var fields map[string]any
+	switch p := payload.(type) {
+	case opencdc.StructuredData:
+		fields = p
+	case opencdc.RawData:
+		if err := json.Unmarshal(p, &fields); err != nil {
+			return ""
+		}
+	}
+
+	var v any = fields
+	for _, name := range strings.Split(path, ".") {
+		switch m := v.(type) {
+		case map[string]any:
+			v = m[name]
+		case opencdc.StructuredData:
+			v = m[name]
+		default:
+			return ""
+		}
+	}
+	if v == nil {
+		return ""
+	}
+	return escapeKeyValue(fmt.Sprint(v))
+}
+
+// escapeKeyValue escapes the slashes of a value rendered from the record's
+// data, percent signs are escaped first, so a "%2F" in the value doesn't
+// collide with an escaped slash.
+func escapeKeyValue(v string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(v, "%", "%25"), "/", "%2F")
+}
+
+func (d keyData) UUID() string {
+	return uuidPlaceholder
+}
+
+func (d keyData) Ext() string {
+	return d.ext
+}
@@ -0,0 +1,132 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
+	"github.com/matryer/is"
+)
+
+func testRecord(position, collection string, createdAt time.Time, payload opencdc.Data) opencdc.Record {
+	m := opencdc.Metadata{}
+	m.SetCollection(collection)
+	m.SetCreatedAt(createdAt)
+	return opencdc.Record{
+		Position:  opencdc.Position(position),
+		Operation: opencdc.OperationCreate,
+		Metadata:  m,
+		Payload:   opencdc.Change{After: payload},
+	}
+}
+
+func TestKeyTemplate_Objects(t *testing.T) {
+	is := is.New(t)
+	tmpl, err := ParseKeyTemplate(`{{.Collection}}/dt={{.Time "2006-01-02"}}/tenant={{.Field "tenant.id"}}/{{.UUID}}.{{.Ext}}`)
+	is.NoErr(err)
+
+	day1 := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	batch := &Batch{Format: format.JSON, Records: []opencdc.Record{
+		testRecord("1", "orders", day1, opencdc.StructuredData{"tenant": map[string]any{"id": "a"}}),
+		testRecord("2", "orders", day2, opencdc.RawData(`{"tenant":{"id":"a"}}`)),
+		testRecord("3", "orders", day1, opencdc.StructuredData{"tenant": map[string]any{"id": "a"}}),
+		testRecord("4", "users", day1, opencdc.RawData("not json")),
+	}}
+
+	objects, err := tmpl.Objects(batch, time.Now())
+	is.NoErr(err)
+	is.Equal(len(objects), 3)
+
+	wantPrefixes := []string{"orders/dt=2024-01-01/tenant=a/", "orders/dt=2024-01-02/tenant=a/", "users/dt=2024-01-01/tenant=/"}
+	wantPositions := [][]string{{"1", "3"}, {"2"}, {"4"}}
+	for i, o := range objects {
+		is.True(strings.HasPrefix(o.Key, wantPrefixes[i]))
+		is.True(strings.HasSuffix(o.Key, ".json"))
+		is.Equal(len(o.Batch.Records), len(wantPositions[i]))
+		for j, r := range o.Batch.Records {
+			is.Equal(string(r.Position), wantPositions[i][j])
+		}
+	}
+	// each object gets its own UUID
+	is.True(strings.TrimPrefix(objects[0].Key, wantPrefixes[0]) != strings.TrimPrefix(objects[2].Key, wantPrefixes[2]))
+}
+
+func TestKeyTemplate_ReadTime(t *testing.T) {
+	is := is.New(t)
+	tmpl, err := ParseKeyTemplate(`{{.Time "15"}}/{{.Metadata "source"}}`)
+	is.NoErr(err)
+
+	now := time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)
+	r := opencdc.Record{Metadata: opencdc.Metadata{"source": "s3"}}
+	objects, err := tmpl.Objects(&Batch{Format: format.JSON, Records: []opencdc.Record{r}}, now)
+	is.NoErr(err)
+	is.Equal(objects[0].Key, "07/s3") // records without a creation or read time use the write time
+
+	r.Metadata.SetReadAt(now.Add(time.Hour))
+	objects, err = tmpl.Objects(&Batch{Format: format.JSON, Records: []opencdc.Record{r}}, now)
+	is.NoErr(err)
+	is.Equal(objects[0].Key, "08/s3")
+}
+
+func TestKeyTemplate_OutsidePrefix(t *testing.T) {
+	is := is.New(t)
+	tmpl, err := ParseKeyTemplate(`{{.Metadata "tenant"}}/{{.Field "id"}}/{{.Key}}`)
+	is.NoErr(err)
+
+	record := func(tenant, id, key string) opencdc.Record {
+		return opencdc.Record{
+			Key:      opencdc.RawData(key),
+			Metadata: opencdc.Metadata{"tenant": tenant},
+			Payload:  opencdc.Change{After: opencdc.StructuredData{"id": id}},
+		}
+	}
+
+	// slashes in metadata values and fields don't add segments
+	key, err := tmpl.Render(record("../a", "b/../../c", "d/e.json"), "json", time.Now())
+	is.NoErr(err)
+	is.Equal(key, "..%2Fa/b%2F..%2F..%2Fc/d/e.json")
+
+	// escaped slashes in values don't collide with slashes
+	slash, err := tmpl.Render(record("a", "b/c", "d"), "json", time.Now())
+	is.NoErr(err)
+	escaped, err := tmpl.Render(record("a", "b%2Fc", "d"), "json", time.Now())
+	is.NoErr(err)
+	is.Equal(slash, "a/b%2Fc/d")
+	is.Equal(escaped, "a/b%252Fc/d")
+
+	for _, r := range []opencdc.Record{
+		record("..", "b", "c"),
+		record("a", ".", "c"),
+		record("a", "b", "../../c"),
+	} {
+		_, err = tmpl.Render(r, "json", time.Now())
+		is.True(err != nil)
+		_, err = tmpl.Objects(&Batch{Format: format.JSON, Records: []opencdc.Record{r}}, time.Now())
+		is.True(err != nil)
+	}
+}
+
+func TestParseKeyTemplate_Invalid(t *testing.T) {
+	is := is.New(t)
+	_, err := ParseKeyTemplate(`{{.Time "2006"`)
+	is.True(err != nil)
+	_, err = ParseKeyTemplate(`{{.Unknown}}`)
+	is.True(err != nil)
+}
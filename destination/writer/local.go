@@ -35,22 +35,24 @@ var _ Writer = (*Local)(nil)
 
 // Write writes a batch into a file on a local file system so it could later be
 // compared to a reference file.
-func (w *Local) Write(_ context.Context, batch *Batch) error {
-	w.Count++
+func (w *Local) Write(ctx context.Context, batch *Batch) error {
+	for _, b := range batch.Split() {
+		w.Count++
 
-	path := path.Join(
-		w.Path,
-		fmt.Sprintf("local-%04d.%s", w.Count, batch.Format.Ext()),
-	)
+		path := path.Join(
+			w.Path,
+			fmt.Sprintf("local-%04d.%s", w.Count, b.Format.Ext()),
+		)
 
-	bytes, err := batch.Bytes()
-	if err != nil {
-		return err
-	}
+		bytes, err := b.Bytes(ctx)
+		if err != nil {
+			return err
+		}
 
-	err = os.WriteFile(path, bytes, 0o600)
-	if err != nil {
-		return err
+		err = os.WriteFile(path, bytes, 0o600)
+		if err != nil {
+			return err
+		}
 	}
 
 	w.Position = batch.LastPosition()
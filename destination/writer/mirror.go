@@ -0,0 +1,176 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/conduitio/conduit-commons/opencdc"
+)
+
+const (
+	// metadataContentType is the metadata key the S3 source stores the
+	// content type of an object in.
+	metadataContentType = "s3.header.contentType"
+	// defaultMirrorKeyTemplate names objects after the record key.
+	defaultMirrorKeyTemplate = "{{.Key}}"
+)
+
+// userMetadataExcludedPrefixes are the prefixes of metadata keys that are
+// added by Conduit or describe the S3 object, they are not user metadata.
+var userMetadataExcludedPrefixes = []string{"opencdc.", "conduit.", "s3."}
+
+// Mirror writes each record to its own object named after the record, and
+// deletes the object of deleted records, so the bucket mirrors the records.
+type Mirror struct {
+	KeyPrefix   string
+	KeyTemplate *KeyTemplate
+	Bucket      string
+	Position    opencdc.Position
+	Client      *s3.Client
+}
+
+var _ Writer = (*Mirror)(nil)
+
+// NewMirror takes an S3Config reference and produces a Mirror Writer, objects
+// are named after the record key if the config has no key template.
+func NewMirror(ctx context.Context, cfg *S3Config) (*Mirror, error) {
+	client, err := cfg.NewS3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	text := cfg.KeyTemplate
+	if text == "" {
+		text = defaultMirrorKeyTemplate
+	}
+	keyTemplate, err := ParseKeyTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mirror{
+		KeyPrefix:   cfg.Prefix,
+		KeyTemplate: keyTemplate,
+		Bucket:      cfg.AWSBucket,
+		Client:      client,
+	}, nil
+}
+
+// Write writes or deletes the object of each record, in the order of the
+// records.
+func (w *Mirror) Write(ctx context.Context, batch *Batch) error {
+	for _, r := range batch.Records {
+		key, err := w.KeyTemplate.Render(r, batch.Format.Ext(), time.Now())
+		if err != nil {
+			return err
+		}
+		key = mirrorKey(w.KeyPrefix, key)
+
+		if r.Operation == opencdc.OperationDelete {
+			err = w.delete(ctx, key)
+		} else {
+			err = w.put(ctx, key, r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Position = batch.LastPosition()
+
+	return nil
+}
+
+// put stores the payload of the record in the object, the content type and
+// user metadata of the record are restored on the object.
+func (w *Mirror) put(ctx context.Context, key string, r opencdc.Record) error {
+	var body []byte
+	if r.Payload.After != nil {
+		body = r.Payload.After.Bytes()
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:               aws.String(w.Bucket),
+		Key:                  aws.String(key),
+		ACL:                  types.ObjectCannedACLPrivate,
+		Body:                 bytes.NewReader(body),
+		ContentLength:        aws.Int64(int64(len(body))),
+		Metadata:             userMetadata(r.Metadata),
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+	}
+	if contentType := r.Metadata[metadataContentType]; contentType != "" {
+		input.ContentType = aws.String(contentType)
+	} else if _, ok := r.Payload.After.(opencdc.StructuredData); ok {
+		input.ContentType = aws.String("application/json")
+	}
+
+	_, err := w.Client.PutObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("could not write object %q: %w", key, err)
+	}
+	return nil
+}
+
+func (w *Mirror) delete(ctx context.Context, key string) error {
+	_, err := w.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(w.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete object %q: %w", key, err)
+	}
+	return nil
+}
+
+// LastPosition returns the last persisted position
+func (w *Mirror) LastPosition() opencdc.Position {
+	return w.Position
+}
+
+// mirrorKey prefixes the key, unlike path.Join it keeps the key as it is, so
+// keys ending with a slash or containing double slashes are mirrored too.
+func mirrorKey(prefix, key string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix + key
+	}
+	return prefix + "/" + key
+}
+
+// userMetadata returns the metadata that is stored as user metadata of an
+// object, i.e. the metadata not added by Conduit or describing the object.
+func userMetadata(m opencdc.Metadata) map[string]string {
+	um := make(map[string]string)
+	for k, v := range m {
+		excluded := false
+		for _, prefix := range userMetadataExcludedPrefixes {
+			if strings.HasPrefix(k, prefix) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			um[k] = v
+		}
+	}
+	return um
+}
@@ -0,0 +1,51 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func TestUserMetadata(t *testing.T) {
+	is := is.New(t)
+	m := opencdc.Metadata{
+		"owner":                 "team-a",
+		"s3.header.contentType": "application/json",
+		"s3.line":               "1",
+		"opencdc.readAt":        "1700000000000000000",
+		"conduit.source.plugin": "s3",
+	}
+	is.Equal(userMetadata(m), map[string]string{"owner": "team-a"})
+}
+
+func TestMirrorKey(t *testing.T) {
+	is := is.New(t)
+	tmpl, err := ParseKeyTemplate(defaultMirrorKeyTemplate)
+	is.NoErr(err)
+
+	key, err := tmpl.Render(opencdc.Record{Key: opencdc.RawData("logs//a.json")}, "bin", time.Now())
+	is.NoErr(err)
+	is.Equal(mirrorKey("", key), "logs//a.json")
+	is.Equal(mirrorKey("backup", key), "backup/logs//a.json")
+	is.Equal(mirrorKey("backup/", "dir/"), "backup/dir/")
+
+	// records without a key can't be mirrored
+	_, err = tmpl.Render(opencdc.Record{}, "bin", time.Now())
+	is.True(err != nil)
+}
@@ -19,14 +19,14 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/config"
 )
 
 // S3FilesWrittenLength defines the number of last filenames an S3 Writer keep
@@ -35,7 +35,10 @@ const S3FilesWrittenLength = 100
 
 // S3 writer stores batch bytes into an S3 bucket as a file.
 type S3 struct {
-	KeyPrefix    string
+	KeyPrefix string
+	// KeyTemplate renders the object keys, objects are named after the
+	// current time if it is nil.
+	KeyTemplate  *KeyTemplate
 	Bucket       string
 	Position     opencdc.Position
 	Error        error
@@ -47,51 +50,94 @@ var _ Writer = (*S3)(nil)
 
 // S3Config is a type used to initialize an S3 Writer
 type S3Config struct {
-	AccessKeyID     string
-	SecretAccessKey string
-	SessionToken    string
-	Region          string
-	Bucket          string
-	KeyPrefix       string
+	config.Config
+	// KeyTemplate renders the object keys, see ParseKeyTemplate.
+	KeyTemplate string
 }
 
 // NewS3 takes an S3Config reference and produces an S3 Writer
 func NewS3(ctx context.Context, cfg *S3Config) (*S3, error) {
-	awsCredsProvider := credentials.NewStaticCredentialsProvider(
-		cfg.AccessKeyID,
-		cfg.SecretAccessKey,
-		cfg.SessionToken,
-	)
-
-	awsConfig, err := config.LoadDefaultConfig(
-		ctx,
-		config.WithRegion(cfg.Region),
-		config.WithCredentialsProvider(awsCredsProvider),
-	)
+	client, err := cfg.NewS3Client(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	var keyTemplate *KeyTemplate
+	if cfg.KeyTemplate != "" {
+		keyTemplate, err = ParseKeyTemplate(cfg.KeyTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &S3{
-		Bucket:       cfg.Bucket,
-		KeyPrefix:    cfg.KeyPrefix,
+		KeyTemplate:  keyTemplate,
+		Bucket:       cfg.AWSBucket,
+		KeyPrefix:    cfg.Prefix,
 		FilesWritten: make([]string, 0, S3FilesWrittenLength),
-		Client:       s3.NewFromConfig(awsConfig),
+		Client:       client,
 	}, nil
 }
 
-// Write stores the batch on AWS S3 as a file
+// Write stores the batch on AWS S3 as a file, or as one file per rendered key
+// if the writer has a key template. Objects that the format can't write to a
+// single file (e.g. Avro records with different schemas) are split into
+// several files, see partKey.
 func (w *S3) Write(ctx context.Context, batch *Batch) error {
-	batchBytes, err := batch.Bytes()
+	objects, err := w.objects(batch)
 	if err != nil {
 		return err
 	}
+	for _, o := range objects {
+		parts := o.Batch.Split()
+		for i, b := range parts {
+			key := o.Key
+			if len(parts) > 1 {
+				key = partKey(key, b.Format.Ext(), i+1)
+			}
+			err = w.put(ctx, key, b)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	w.Position = batch.LastPosition()
 
-	key := fmt.Sprintf(
-		"%d.%s",
-		time.Now().UnixNano(),
-		batch.Format.Ext(),
-	)
+	return nil
+}
+
+// objects groups the records of the batch into the objects they are written
+// to.
+func (w *S3) objects(batch *Batch) ([]Object, error) {
+	if w.KeyTemplate == nil {
+		key := fmt.Sprintf(
+			"%d.%s",
+			time.Now().UnixNano(),
+			batch.Format.Ext(),
+		)
+		return []Object{{Key: key, Batch: batch}}, nil
+	}
+	return w.KeyTemplate.Objects(batch, time.Now())
+}
+
+// partKey returns the key of the nth file an object is split into, the part
+// number is added before the file extension, e.g. "data-2.avro".
+func partKey(key, ext string, n int) string {
+	base, hasExt := strings.CutSuffix(key, "."+ext)
+	if !hasExt {
+		return fmt.Sprintf("%s-%d", key, n)
+	}
+	return fmt.Sprintf("%s-%d.%s", base, n, ext)
+}
+
+// put stores the batch in an object with the key, it is prefixed by the key
+// prefix.
+func (w *S3) put(ctx context.Context, key string, batch *Batch) error {
+	batchBytes, err := batch.Bytes(ctx)
+	if err != nil {
+		return err
+	}
 
 	if w.KeyPrefix != "" {
 		key = path.Join(w.KeyPrefix, key)
@@ -119,8 +165,6 @@ func (w *S3) Write(ctx context.Context, batch *Batch) error {
 		w.FilesWritten = w.FilesWritten[len(w.FilesWritten)-S3FilesWrittenLength:]
 	}
 
-	w.Position = batch.LastPosition()
-
 	return nil
 }
 
@@ -0,0 +1,27 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestPartKey(t *testing.T) {
+	is := is.New(t)
+	is.Equal(partKey("orders/dt=2024-01-01/data.avro", "avro", 2), "orders/dt=2024-01-01/data-2.avro")
+	is.Equal(partKey("orders/data", "avro", 1), "orders/data-1")
+}
@@ -15,17 +15,151 @@
 package source
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/conduitio/conduit-connector-s3/config"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
+	"github.com/conduitio/conduit-connector-s3/source/iterator"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 )
 
 const (
 	// ConfigKeyPollingPeriod is the config name for the S3 CDC polling period
 	ConfigKeyPollingPeriod = "pollingPeriod"
+
+	// ConfigKeySplitMode is the config name for the record splitting mode
+	ConfigKeySplitMode = "splitMode"
+
+	// ConfigKeyLocations is the config name for the bucket and prefix pairs
+	ConfigKeyLocations = "locations"
+
+	// ConfigKeySnapshotPrefetchConcurrency is the config name for the number
+	// of objects prefetched in parallel during the snapshot
+	ConfigKeySnapshotPrefetchConcurrency = "snapshot.prefetch.concurrency"
+
+	// ConfigKeySnapshotPrefetchMemoryLimit is the config name for the memory
+	// used by prefetched objects
+	ConfigKeySnapshotPrefetchMemoryLimit = "snapshot.prefetch.memoryLimit"
+
+	// ConfigKeyCDCMode is the config name for the change detection mode
+	ConfigKeyCDCMode = "cdc.mode"
+
+	// ConfigKeyCDCFetchConcurrency is the config name for the number of
+	// changes fetched in parallel
+	ConfigKeyCDCFetchConcurrency = "cdc.fetchConcurrency"
+
+	// ConfigKeyCDCBufferSize is the config name for the number of buffered
+	// records
+	ConfigKeyCDCBufferSize = "cdc.bufferSize"
+
+	// ConfigKeyCDCSQSQueueURL is the config name for the SQS queue URL
+	ConfigKeyCDCSQSQueueURL = "cdc.sqs.queueUrl"
+
+	// ConfigKeyCDCSQSEndpoint is the config name for the SQS endpoint
+	ConfigKeyCDCSQSEndpoint = "cdc.sqs.endpoint"
+
+	// ConfigKeyCDCSQSWaitTime is the config name for the SQS long polling
+	// duration
+	ConfigKeyCDCSQSWaitTime = "cdc.sqs.waitTime"
+
+	// ConfigKeyCDCSQSVisibilityTimeout is the config name for the visibility
+	// timeout of received SQS messages
+	ConfigKeyCDCSQSVisibilityTimeout = "cdc.sqs.visibilityTimeout"
+
+	// ConfigKeyCDCIndexDir is the config name for the directory the object
+	// index is persisted in
+	ConfigKeyCDCIndexDir = "cdc.index.dir"
+
+	// ConfigKeyCDCIndexMemoryLimit is the config name for the number of
+	// index entries kept in memory
+	ConfigKeyCDCIndexMemoryLimit = "cdc.index.memoryLimit"
+
+	// ConfigKeyCDCBeforeEnabled is the config name for the toggle attaching
+	// the previous object version to updates and deletes
+	ConfigKeyCDCBeforeEnabled = "cdc.before.enabled"
+
+	// ConfigKeyCDCBeforeMaxSize is the config name for the maximum size of
+	// the attached previous object version
+	ConfigKeyCDCBeforeMaxSize = "cdc.before.maxSize"
+
+	// ConfigKeyCompression is the config name for the object compression
+	ConfigKeyCompression = "compression"
+
+	// ConfigKeyFormat is the config name for the format of files written by
+	// the S3 destination
+	ConfigKeyFormat = "format"
+
+	// ConfigKeyFilterInclude is the config name for the key include patterns
+	ConfigKeyFilterInclude = "filter.include"
+
+	// ConfigKeyFilterExclude is the config name for the key exclude patterns
+	ConfigKeyFilterExclude = "filter.exclude"
+
+	// ConfigKeyFilterMinSize is the config name for the minimum object size
+	ConfigKeyFilterMinSize = "filter.minSize"
+
+	// ConfigKeyFilterMaxSize is the config name for the maximum object size
+	ConfigKeyFilterMaxSize = "filter.maxSize"
+
+	// ConfigKeyFilterContentTypes is the config name for the allowed content
+	// types
+	ConfigKeyFilterContentTypes = "filter.contentTypes"
+
+	// ConfigKeyCSVDelimiter is the config name for the CSV field delimiter
+	ConfigKeyCSVDelimiter = "csv.delimiter"
+
+	// ConfigKeyCSVQuote is the config name for the CSV quote character
+	ConfigKeyCSVQuote = "csv.quote"
+
+	// ConfigKeyCSVHeader is the config name for the CSV header row toggle
+	ConfigKeyCSVHeader = "csv.header"
+
+	// ConfigKeyCSVColumns is the config name for the CSV column names
+	ConfigKeyCSVColumns = "csv.columns"
+
+	// ConfigKeyCSVColumnTypes is the config name for the CSV column types
+	ConfigKeyCSVColumnTypes = "csv.columnTypes"
+
+	// ConfigKeyLargeObjectsMaxSize is the config name for the maximum object
+	// size
+	ConfigKeyLargeObjectsMaxSize = "largeObjects.maxSize"
+
+	// ConfigKeyLargeObjectsPolicy is the config name for the policy for
+	// objects larger than the maximum object size
+	ConfigKeyLargeObjectsPolicy = "largeObjects.policy"
+
+	// ConfigKeyLargeObjectsChunkSize is the config name for the size of the
+	// chunks large objects are split into
+	ConfigKeyLargeObjectsChunkSize = "largeObjects.chunkSize"
+
+	// ConfigKeyPostProcessAction is the config name for the action run on
+	// processed objects
+	ConfigKeyPostProcessAction = "postProcess.action"
+
+	// ConfigKeyPostProcessTag is the config name for the tag added to
+	// processed objects
+	ConfigKeyPostProcessTag = "postProcess.tag"
+
+	// ConfigKeyPostProcessArchivePrefix is the config name for the prefix
+	// processed objects are moved to
+	ConfigKeyPostProcessArchivePrefix = "postProcess.archivePrefix"
+
+	// ConfigKeyPostProcessArchiveBucket is the config name for the bucket
+	// processed objects are moved to
+	ConfigKeyPostProcessArchiveBucket = "postProcess.archiveBucket"
 )
 
+// s3URLScheme prefixes locations in other buckets than aws.bucket.
+const s3URLScheme = "s3://"
+
+// formatRaw is the format value for objects that are not decoded.
+const formatRaw = "raw"
+
 // Config represents source configuration with S3 configurations
 type Config struct {
 	sdk.DefaultSourceMiddleware
@@ -33,4 +167,463 @@ type Config struct {
 
 	// polling period for the CDC mode, formatted as a time.Duration string.
 	PollingPeriod time.Duration `json:"pollingPeriod" default:"1s"`
+	// Snapshot configures how objects are fetched during the snapshot.
+	Snapshot SnapshotConfig `json:"snapshot"`
+	// CDC configures how changes are detected after the snapshot.
+	CDC CDCConfig `json:"cdc"`
+	// locations to read instead of a single prefix, each location is either
+	// a prefix in aws.bucket or "s3://bucket/prefix" to read another bucket
+	// (e.g. "logs/,s3://other-bucket/events/"). Each location is tracked
+	// separately in the position and added to the opencdc.collection
+	// metadata as "bucket/prefix". Can't be combined with prefix.
+	Locations []string `json:"locations"`
+	// how objects are split into records, either "object" to produce one
+	// record per object, "newline" to produce one record per line (e.g.
+	// for JSON Lines or text files), "csv" to parse objects as CSV or
+	// "parquet" to read Parquet objects, both producing one structured record
+	// per row.
+	SplitMode iterator.SplitMode `json:"splitMode" default:"object" validate:"inclusion=object|newline|csv|parquet"`
+	// compression of the objects, "auto" detects it based on the object's
+	// Content-Encoding, content type or key extension (e.g. ".gz", ".zst"),
+	// "none" reads objects as they are stored, "gzip", "zstd", "bzip2",
+	// "snappy" (framing format) or "hadoop-snappy" (Hadoop's block format)
+	// decompress all objects with that algorithm. Objects are decompressed
+	// before they are split into records.
+	Compression iterator.Compression `json:"compression" default:"auto" validate:"inclusion=auto|none|gzip|zstd|bzip2|snappy|hadoop-snappy"`
+	// format of the objects, "raw" reads objects as configured by splitMode,
+	// "json" or "parquet" decode files written by the S3 destination in that
+	// format back into the original records, restoring their operation, key,
+	// payload and metadata. Can't be combined with splitMode.
+	Format string `json:"format" default:"raw" validate:"inclusion=raw|json|parquet"`
+	// CSV parsing options, only used if splitMode is "csv".
+	CSV CSVConfig `json:"csv"`
+	// Filter decides which objects are read.
+	Filter FilterConfig `json:"filter"`
+	// LargeObjects configures how objects larger than the maximum object
+	// size are handled.
+	LargeObjects LargeObjectsConfig `json:"largeObjects"`
+	// PostProcess configures what happens to objects once all records read
+	// from them are acknowledged.
+	PostProcess PostProcessConfig `json:"postProcess"`
+}
+
+// SnapshotConfig contains the options for the snapshot.
+type SnapshotConfig struct {
+	// Prefetch configures fetching objects in the background.
+	Prefetch PrefetchConfig `json:"prefetch"`
+}
+
+// PrefetchConfig contains the options for prefetching objects during the
+// snapshot. Records are still returned in key order.
+type PrefetchConfig struct {
+	// number of objects of the current listing page fetched in parallel
+	// ahead of the object that is read, 0 fetches one object at a time.
+	Concurrency int `json:"concurrency" default:"4" validate:"greater-than=-1"`
+	// maximum number of bytes of prefetched objects kept in memory, objects
+	// that don't fit are fetched once they are read. Only objects that are
+	// read as a whole are prefetched, other objects are streamed. The limit
+	// is shared by all locations and the changes fetched in parallel by CDC.
+	MemoryLimit int64 `json:"memoryLimit" default:"67108864" validate:"greater-than=-1"`
+}
+
+// CDCMode defines how changes are detected.
+type CDCMode string
+
+const (
+	// CDCModePolling lists the bucket every polling period.
+	CDCModePolling CDCMode = "polling"
+	// CDCModeSQS consumes S3 event notifications from an SQS queue.
+	CDCModeSQS CDCMode = "sqs"
+	// CDCModeUnversioned lists the bucket every polling period and compares
+	// the objects to an index of the previous listing.
+	CDCModeUnversioned CDCMode = "unversioned"
+)
+
+// CDCConfig contains the options for detecting changes.
+type CDCConfig struct {
+	// how changes are detected, "polling" lists all object versions every
+	// polling period, "sqs" consumes S3 event notifications (ObjectCreated and
+	// ObjectRemoved) from an SQS queue, "unversioned" lists the current
+	// objects every polling period and compares them to an index of the
+	// previous listing, for buckets without versioning.
+	Mode CDCMode `json:"mode" default:"polling" validate:"inclusion=polling|sqs|unversioned"`
+	// number of detected changes fetched in parallel in the "polling" and
+	// "unversioned" modes, records are still returned in the order the
+	// changes were made.
+	FetchConcurrency int `json:"fetchConcurrency" default:"4" validate:"greater-than=0"`
+	// number of records buffered before they are read in the "polling" and
+	// "unversioned" modes.
+	BufferSize int `json:"bufferSize" default:"100" validate:"greater-than=0"`
+	// SQS options, only used if the mode is "sqs".
+	SQS SQSConfig `json:"sqs"`
+	// index options, only used if the mode is "unversioned".
+	Index IndexConfig `json:"index"`
+	// Before configures attaching the previous object version to updates and
+	// deletes, only supported if the mode is "polling".
+	Before BeforeConfig `json:"before"`
+}
+
+// BeforeConfig contains the options for attaching the previous version of
+// updated and deleted objects.
+type BeforeConfig struct {
+	// whether the body of the previous object version is attached as the
+	// before payload of updates and deletes. Its version ID is added to the
+	// metadata as "s3.before.versionId" and its metadata with the prefix
+	// "s3.before.", e.g. "s3.before.s3.header.contentType". Requires an
+	// additional GET request per change and splitMode "object".
+	Enabled bool `json:"enabled" default:"false"`
+	// maximum size of the attached previous version in bytes, the body of
+	// larger versions is not fetched, only their version ID is added to the
+	// metadata.
+	MaxSize int64 `json:"maxSize" default:"1048576" validate:"greater-than=-1"`
+}
+
+// IndexConfig contains the options for the index of the objects found by the
+// last listing, which is used to detect changes in buckets without
+// versioning.
+type IndexConfig struct {
+	// directory the index of each location is persisted in, so changes made
+	// while the connector was stopped are detected after a restart. Each
+	// source needs its own directory. If empty, the index is rebuilt after a
+	// restart, which only detects objects created or updated after the last
+	// position.
+	Dir string `json:"dir"`
+	// number of objects per location kept in memory, larger indexes are
+	// spilled to a file in the index directory, or in the temporary
+	// directory if no index directory is set.
+	MemoryLimit int `json:"memoryLimit" default:"100000" validate:"greater-than=-1"`
+}
+
+// LargeObjectsConfig contains the options for objects that are too large to
+// be read at once.
+type LargeObjectsConfig struct {
+	// size in bytes of the largest object that is read as configured by
+	// splitMode or format, 0 means there is no limit. Objects are limited by
+	// their stored size, before they are decompressed.
+	MaxSize int64 `json:"maxSize" default:"0" validate:"greater-than=-1"`
+	// what happens with objects larger than largeObjects.maxSize, "fail"
+	// stops the source with an error, "skip" skips the object and logs a
+	// warning, "split" produces one record per chunk of the object, fetching
+	// each chunk with a ranged GET. Splitting requires splitMode "object"
+	// and format "raw".
+	Policy iterator.LargeObjectPolicy `json:"policy" default:"fail" validate:"inclusion=fail|skip|split"`
+	// size in bytes of the chunks large objects are split into, defaults to
+	// largeObjects.maxSize. Can't be greater than largeObjects.maxSize.
+	ChunkSize int64 `json:"chunkSize" default:"0" validate:"greater-than=-1"`
+}
+
+// validateLargeObjects checks that large objects can be split, only whole objects that
+// are not decoded can be split into chunks.
+func (c *Config) validateLargeObjects() error {
+	var errs []error
+	if c.LargeObjects.Policy == iterator.LargeObjectSplit && (c.SplitMode != iterator.SplitModeObject || c.Format != formatRaw) {
+		errs = append(errs, fmt.Errorf("%q %q requires %q %q and %q %q", ConfigKeyLargeObjectsPolicy, iterator.LargeObjectSplit, ConfigKeySplitMode, iterator.SplitModeObject, ConfigKeyFormat, formatRaw))
+	}
+	if c.LargeObjects.ChunkSize > 0 && c.LargeObjects.ChunkSize > c.LargeObjects.MaxSize {
+		errs = append(errs, fmt.Errorf("%q can't be greater than %q", ConfigKeyLargeObjectsChunkSize, ConfigKeyLargeObjectsMaxSize))
+	}
+	return errors.Join(errs...)
+}
+
+// SQSConfig contains the options for consuming S3 event notifications from
+// SQS.
+type SQSConfig struct {
+	// URL of the SQS queue receiving the S3 event notifications of the
+	// bucket, either directly or through SNS.
+	QueueURL string `json:"queueUrl"`
+	// custom SQS endpoint, e.g. to use an SQS-compatible queue like
+	// ElasticMQ.
+	Endpoint string `json:"endpoint"`
+	// how long a receive call waits for messages (long polling), at most
+	// 20s.
+	WaitTime time.Duration `json:"waitTime" default:"20s"`
+	// maximum number of messages received at once, between 1 and 10.
+	MaxMessages int `json:"maxMessages" default:"10" validate:"greater-than=0,less-than=11"`
+	// how long received messages are hidden from other consumers, at most
+	// 12h. It is extended until all records of a message are acknowledged,
+	// 0 uses the visibility timeout of the queue without extending it.
+	VisibilityTimeout time.Duration `json:"visibilityTimeout" default:"30s"`
+}
+
+// FilterConfig contains the options for filtering objects, filtered objects
+// are skipped before they are downloaded.
+type FilterConfig struct {
+	// patterns of which at least one needs to match an object key for the
+	// object to be read, all objects are read if empty. Patterns are globs
+	// (e.g. "**/*.json", "*" doesn't match "/" while "**" does) or regular
+	// expressions if prefixed with "regex:" (e.g. "regex:^logs/[0-9]+/").
+	Include []string `json:"include"`
+	// patterns of which none may match an object key for the object to be
+	// read, e.g. "**/_SUCCESS", "**/*.tmp" or "**/" for directory
+	// placeholders. Uses the same syntax as the include patterns.
+	Exclude []string `json:"exclude"`
+	// minimum size of an object in bytes.
+	MinSize int64 `json:"minSize" default:"0" validate:"greater-than=-1"`
+	// maximum size of an object in bytes, 0 means no limit.
+	MaxSize int64 `json:"maxSize" default:"0" validate:"greater-than=-1"`
+	// content types of the objects to read, e.g. "application/json" or
+	// "text/*". All objects are read if empty. Checking the content type
+	// requires an additional HEAD request per object.
+	ContentTypes []string `json:"contentTypes"`
+}
+
+func (c SQSConfig) validate() error {
+	var errs []error
+	if c.QueueURL == "" {
+		errs = append(errs, fmt.Errorf("%q is required if %q is %q", ConfigKeyCDCSQSQueueURL, ConfigKeyCDCMode, CDCModeSQS))
+	}
+	if c.WaitTime < 0 || c.WaitTime > 20*time.Second {
+		errs = append(errs, fmt.Errorf("%q needs to be between 0s and 20s", ConfigKeyCDCSQSWaitTime))
+	}
+	if c.VisibilityTimeout != 0 && (c.VisibilityTimeout < 2*time.Second || c.VisibilityTimeout > 12*time.Hour) {
+		errs = append(errs, fmt.Errorf("%q needs to be 0s or between 2s and 12h", ConfigKeyCDCSQSVisibilityTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+// ConsumerConfig converts the config into the config used by the SQS
+// consumer.
+func (c SQSConfig) ConsumerConfig() iterator.SQSConfig {
+	return iterator.SQSConfig{
+		QueueURL:          c.QueueURL,
+		WaitTime:          c.WaitTime,
+		MaxMessages:       int32(c.MaxMessages), //nolint:gosec // validated to be between 1 and 10
+		VisibilityTimeout: c.VisibilityTimeout,
+	}
+}
+
+// ObjectFilter converts the config into the filter used by the iterators.
+func (c FilterConfig) ObjectFilter() (iterator.ObjectFilter, error) {
+	var errs []error
+	parse := func(key string, patterns []string) []*regexp.Regexp {
+		var res []*regexp.Regexp
+		for _, p := range patterns {
+			re, err := iterator.ParsePattern(p)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%q: %w", key, err))
+				continue
+			}
+			res = append(res, re)
+		}
+		return res
+	}
+
+	f := iterator.ObjectFilter{
+		Include:      parse(ConfigKeyFilterInclude, c.Include),
+		Exclude:      parse(ConfigKeyFilterExclude, c.Exclude),
+		MinSize:      c.MinSize,
+		MaxSize:      c.MaxSize,
+		ContentTypes: c.ContentTypes,
+	}
+	if c.MaxSize > 0 && c.MinSize > c.MaxSize {
+		errs = append(errs, fmt.Errorf("%q can't be greater than %q", ConfigKeyFilterMinSize, ConfigKeyFilterMaxSize))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return iterator.ObjectFilter{}, err
+	}
+	return f, nil
+}
+
+// CSVConfig contains the options for parsing CSV objects.
+type CSVConfig struct {
+	// the character separating fields.
+	Delimiter string `json:"delimiter" default:","`
+	// the character used to quote fields.
+	Quote string `json:"quote" default:"\""`
+	// whether the first row of each object contains the column names.
+	Header bool `json:"header" default:"true"`
+	// column names used if objects don't have a header row. Columns without
+	// a name are named "column1", "column2" etc. based on their position.
+	Columns []string `json:"columns"`
+	// column types as a list of "name:type" pairs, where type is one of
+	// "string", "int", "float" or "bool". Columns without a type are strings.
+	ColumnTypes []string `json:"columnTypes"`
+}
+
+// Options converts the config into the options used by the CSV reader.
+func (c CSVConfig) Options() (iterator.CSVOptions, error) {
+	var errs []error
+
+	delimiter, err := singleRune(ConfigKeyCSVDelimiter, c.Delimiter)
+	errs = append(errs, err)
+	quote, err := singleRune(ConfigKeyCSVQuote, c.Quote)
+	errs = append(errs, err)
+	if err == nil && delimiter == quote {
+		errs = append(errs, fmt.Errorf("%q and %q can't be the same character", ConfigKeyCSVDelimiter, ConfigKeyCSVQuote))
+	}
+
+	columnTypes := make(map[string]iterator.CSVColumnType, len(c.ColumnTypes))
+	for _, ct := range c.ColumnTypes {
+		name, typ, ok := strings.Cut(ct, ":")
+		if !ok || name == "" {
+			errs = append(errs, fmt.Errorf("%q: invalid column type %q, expected \"name:type\"", ConfigKeyCSVColumnTypes, ct))
+			continue
+		}
+		t, err := iterator.ParseCSVColumnType(typ)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", ConfigKeyCSVColumnTypes, err))
+			continue
+		}
+		columnTypes[name] = t
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return iterator.CSVOptions{}, err
+	}
+	return iterator.CSVOptions{
+		Delimiter:   delimiter,
+		Quote:       quote,
+		Header:      c.Header,
+		Columns:     c.Columns,
+		ColumnTypes: columnTypes,
+	}, nil
+}
+
+func singleRune(key, s string) (rune, error) {
+	r := []rune(s)
+	if len(r) != 1 {
+		return 0, fmt.Errorf("%q needs to be a single character, got %q", key, s)
+	}
+	return r[0], nil
+}
+
+// Validate runs the SDK middleware validation and the shared S3 config
+// validation.
+func (c *Config) Validate(ctx context.Context) error {
+	var csvErr error
+	if c.SplitMode == iterator.SplitModeCSV {
+		_, csvErr = c.CSV.Options()
+	}
+	var cdcErr, beforeErr error
+	if c.CDC.Mode == CDCModeSQS {
+		cdcErr = c.CDC.SQS.validate()
+	}
+	if c.CDC.Before.Enabled {
+		beforeErr = c.validateBefore()
+	}
+	locations, locationsErr := c.ReadLocations()
+	var postProcessErr error
+	if locationsErr == nil {
+		postProcessErr = c.PostProcess.validate(locations, c.CDC.Mode)
+	}
+	_, filterErr := c.Filter.ObjectFilter()
+	var formatErr error
+	if c.Format != formatRaw && c.SplitMode != iterator.SplitModeObject {
+		formatErr = fmt.Errorf("%q can't be combined with %q %q", ConfigKeySplitMode, ConfigKeyFormat, c.Format)
+	}
+	return errors.Join(
+		c.DefaultSourceMiddleware.Validate(ctx),
+		c.Config.Validate(ctx),
+		cdcErr,
+		beforeErr,
+		locationsErr,
+		csvErr,
+		filterErr,
+		formatErr,
+		c.validateLargeObjects(),
+		postProcessErr,
+	)
+}
+
+// validateBefore checks that the previous object version can be attached, it
+// is only known when listing object versions and attached as a whole.
+func (c *Config) validateBefore() error {
+	var errs []error
+	if c.CDC.Mode != CDCModePolling {
+		errs = append(errs, fmt.Errorf("%q requires %q %q", ConfigKeyCDCBeforeEnabled, ConfigKeyCDCMode, CDCModePolling))
+	}
+	if c.SplitMode != iterator.SplitModeObject || c.Format != formatRaw {
+		errs = append(errs, fmt.Errorf("%q requires %q %q and %q %q", ConfigKeyCDCBeforeEnabled, ConfigKeySplitMode, iterator.SplitModeObject, ConfigKeyFormat, formatRaw))
+	}
+	return errors.Join(errs...)
+}
+
+// SnapshotIteratorConfig returns the config used by the snapshot iterator to
+// fetch objects.
+func (c *Config) SnapshotIteratorConfig() iterator.SnapshotConfig {
+	return iterator.SnapshotConfig{
+		PrefetchConcurrency: c.Snapshot.Prefetch.Concurrency,
+		PrefetchMemoryLimit: c.Snapshot.Prefetch.MemoryLimit,
+	}
+}
+
+// CDCIteratorConfig returns the config used by the CDC iterator to detect
+// changes by listing the bucket.
+func (c *Config) CDCIteratorConfig() iterator.CDCConfig {
+	return iterator.CDCConfig{
+		PollingPeriod:    c.PollingPeriod,
+		Unversioned:      c.CDC.Mode == CDCModeUnversioned,
+		IndexDir:         c.CDC.Index.Dir,
+		IndexMemoryLimit: c.CDC.Index.MemoryLimit,
+		IncludeBefore:    c.CDC.Before.Enabled,
+		BeforeMaxSize:    c.CDC.Before.MaxSize,
+		FetchConcurrency: c.CDC.FetchConcurrency,
+		BufferSize:       c.CDC.BufferSize,
+	}
+}
+
+// ReadLocations returns the bucket and prefix pairs read by the source.
+func (c *Config) ReadLocations() ([]iterator.Location, error) {
+	if len(c.Locations) == 0 {
+		return []iterator.Location{{Bucket: c.AWSBucket, Prefix: c.Prefix}}, nil
+	}
+	if c.Prefix != "" {
+		return nil, fmt.Errorf("%q can't be combined with %q", config.ConfigKeyPrefix, ConfigKeyLocations)
+	}
+
+	var errs []error
+	locations := make([]iterator.Location, 0, len(c.Locations))
+	seen := make(map[string]bool, len(c.Locations))
+	for _, l := range c.Locations {
+		location := iterator.Location{Bucket: c.AWSBucket, Prefix: l}
+		if rest, ok := strings.CutPrefix(l, s3URLScheme); ok {
+			location.Bucket, location.Prefix, _ = strings.Cut(rest, "/")
+			if location.Bucket == "" {
+				errs = append(errs, fmt.Errorf("%q: location %q doesn't contain a bucket", ConfigKeyLocations, l))
+				continue
+			}
+		}
+		if seen[location.Collection()] {
+			errs = append(errs, fmt.Errorf("%q: duplicate location %q", ConfigKeyLocations, l))
+			continue
+		}
+		seen[location.Collection()] = true
+		locations = append(locations, location)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// ReaderConfig returns the config used by the iterators to turn objects into
+// records.
+func (c *Config) ReaderConfig() (iterator.ReaderConfig, error) {
+	filter, err := c.Filter.ObjectFilter()
+	if err != nil {
+		return iterator.ReaderConfig{}, err
+	}
+	rc := iterator.ReaderConfig{
+		Filter:        filter,
+		SplitMode:     c.SplitMode,
+		Compression:   c.Compression,
+		MaxObjectSize: c.LargeObjects.MaxSize,
+		LargeObjects:  c.LargeObjects.Policy,
+		ChunkSize:     c.LargeObjects.ChunkSize,
+	}
+	if c.Format != formatRaw {
+		rc.Format, err = format.Parse(c.Format)
+		if err != nil {
+			return iterator.ReaderConfig{}, err
+		}
+	}
+	if c.SplitMode == iterator.SplitModeCSV {
+		rc.CSV, err = c.CSV.Options()
+		if err != nil {
+			return iterator.ReaderConfig{}, err
+		}
+	}
+	return rc, nil
 }
@@ -20,6 +20,8 @@ import (
 
 	cconfig "github.com/conduitio/conduit-commons/config"
 	"github.com/conduitio/conduit-connector-s3/config"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
+	"github.com/conduitio/conduit-connector-s3/source/iterator"
 	"github.com/matryer/is"
 )
 
@@ -48,3 +50,210 @@ func TestParseConfig(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(want, got)
 }
+
+func TestCSVConfig_Options(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  CSVConfig
+		want    iterator.CSVOptions
+		wantErr bool
+	}{{
+		name: "valid",
+		config: CSVConfig{
+			Delimiter:   ";",
+			Quote:       "'",
+			Header:      true,
+			ColumnTypes: []string{"id:int", "price:float"},
+		},
+		want: iterator.CSVOptions{
+			Delimiter: ';',
+			Quote:     '\'',
+			Header:    true,
+			ColumnTypes: map[string]iterator.CSVColumnType{
+				"id":    iterator.CSVColumnTypeInt,
+				"price": iterator.CSVColumnTypeFloat,
+			},
+		},
+	}, {
+		name:    "multi character delimiter",
+		config:  CSVConfig{Delimiter: ";;", Quote: `"`},
+		wantErr: true,
+	}, {
+		name:    "same delimiter and quote",
+		config:  CSVConfig{Delimiter: ",", Quote: ","},
+		wantErr: true,
+	}, {
+		name:    "unsupported column type",
+		config:  CSVConfig{Delimiter: ",", Quote: `"`, ColumnTypes: []string{"id:uuid"}},
+		wantErr: true,
+	}, {
+		name:    "column type without name",
+		config:  CSVConfig{Delimiter: ",", Quote: `"`, ColumnTypes: []string{"int"}},
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := tc.config.Options()
+			if tc.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestConfig_ReaderConfig_Format(t *testing.T) {
+	is := is.New(t)
+	cfg := Config{SplitMode: iterator.SplitModeObject, Format: "parquet"}
+
+	got, err := cfg.ReaderConfig()
+	is.NoErr(err)
+	is.Equal(got, iterator.ReaderConfig{SplitMode: iterator.SplitModeObject, Format: format.Parquet})
+
+	cfg.Format = formatRaw
+	got, err = cfg.ReaderConfig()
+	is.NoErr(err)
+	is.Equal(got, iterator.ReaderConfig{SplitMode: iterator.SplitModeObject})
+}
+
+func TestFilterConfig_ObjectFilter(t *testing.T) {
+	is := is.New(t)
+
+	f, err := FilterConfig{Include: []string{"**/*.json"}, Exclude: []string{"regex:_SUCCESS$"}}.ObjectFilter()
+	is.NoErr(err)
+	is.True(f.MatchKey("dir/a.json"))
+	is.True(!f.MatchKey("dir/_SUCCESS"))
+
+	_, err = FilterConfig{Exclude: []string{"regex:("}}.ObjectFilter()
+	is.True(err != nil)
+
+	_, err = FilterConfig{MinSize: 10, MaxSize: 5}.ObjectFilter()
+	is.True(err != nil)
+}
+
+func TestConfig_ReadLocations(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  Config
+		want    []iterator.Location
+		wantErr bool
+	}{{
+		name:   "single prefix",
+		config: Config{Config: config.Config{AWSBucket: "bucket", Prefix: "logs/"}},
+		want:   []iterator.Location{{Bucket: "bucket", Prefix: "logs/"}},
+	}, {
+		name: "locations",
+		config: Config{
+			Config:    config.Config{AWSBucket: "bucket"},
+			Locations: []string{"logs/", "s3://other/events/", "s3://third"},
+		},
+		want: []iterator.Location{
+			{Bucket: "bucket", Prefix: "logs/"},
+			{Bucket: "other", Prefix: "events/"},
+			{Bucket: "third", Prefix: ""},
+		},
+	}, {
+		name: "locations and prefix",
+		config: Config{
+			Config:    config.Config{AWSBucket: "bucket", Prefix: "logs/"},
+			Locations: []string{"events/"},
+		},
+		wantErr: true,
+	}, {
+		name: "duplicate location",
+		config: Config{
+			Config:    config.Config{AWSBucket: "bucket"},
+			Locations: []string{"logs/", "s3://bucket/logs/"},
+		},
+		wantErr: true,
+	}, {
+		name: "missing bucket",
+		config: Config{
+			Config:    config.Config{AWSBucket: "bucket"},
+			Locations: []string{"s3:///logs/"},
+		},
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := tc.config.ReadLocations()
+			if tc.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestConfig_ValidateBefore(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{{
+		name:   "polling",
+		config: Config{CDC: CDCConfig{Mode: CDCModePolling}, SplitMode: iterator.SplitModeObject, Format: formatRaw},
+	}, {
+		name:    "unversioned",
+		config:  Config{CDC: CDCConfig{Mode: CDCModeUnversioned}, SplitMode: iterator.SplitModeObject, Format: formatRaw},
+		wantErr: true,
+	}, {
+		name:    "split into lines",
+		config:  Config{CDC: CDCConfig{Mode: CDCModePolling}, SplitMode: iterator.SplitModeNewline, Format: formatRaw},
+		wantErr: true,
+	}, {
+		name:    "destination format",
+		config:  Config{CDC: CDCConfig{Mode: CDCModePolling}, SplitMode: iterator.SplitModeObject, Format: "json"},
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			err := tc.config.validateBefore()
+			is.Equal(err != nil, tc.wantErr)
+		})
+	}
+}
+
+func TestConfig_ValidateLargeObjects(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{{
+		name:   "split objects",
+		config: Config{LargeObjects: LargeObjectsConfig{MaxSize: 10, Policy: iterator.LargeObjectSplit, ChunkSize: 5}, SplitMode: iterator.SplitModeObject, Format: formatRaw},
+	}, {
+		name:   "skip lines",
+		config: Config{LargeObjects: LargeObjectsConfig{MaxSize: 10, Policy: iterator.LargeObjectSkip}, SplitMode: iterator.SplitModeNewline, Format: formatRaw},
+	}, {
+		name:    "split lines",
+		config:  Config{LargeObjects: LargeObjectsConfig{MaxSize: 10, Policy: iterator.LargeObjectSplit}, SplitMode: iterator.SplitModeNewline, Format: formatRaw},
+		wantErr: true,
+	}, {
+		name:    "split destination format",
+		config:  Config{LargeObjects: LargeObjectsConfig{MaxSize: 10, Policy: iterator.LargeObjectSplit}, SplitMode: iterator.SplitModeObject, Format: "json"},
+		wantErr: true,
+	}, {
+		name:    "chunks larger than objects",
+		config:  Config{LargeObjects: LargeObjectsConfig{MaxSize: 10, Policy: iterator.LargeObjectSplit, ChunkSize: 11}, SplitMode: iterator.SplitModeObject, Format: formatRaw},
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			err := tc.config.validateLargeObjects()
+			is.Equal(err != nil, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/conduitio/conduit-commons/opencdc"
+)
+
+// ackFunc acknowledges a record, it is nil for records that don't need to
+// be acknowledged.
+type ackFunc func(ctx context.Context) error
+
+// combineAcks returns an ackFunc calling all non-nil acks, it is nil if all
+// of them are nil.
+func combineAcks(acks ...ackFunc) ackFunc {
+	var nonNil []ackFunc
+	for _, ack := range acks {
+		if ack != nil {
+			nonNil = append(nonNil, ack)
+		}
+	}
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	}
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, ack := range nonNil {
+			errs = append(errs, ack(ctx))
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// AckedObject is an object of which all records were acknowledged.
+type AckedObject struct {
+	Bucket string
+	Key    string
+	// VersionID is the version that was read, empty if the bucket isn't
+	// versioned.
+	VersionID string
+	// ETag is the entity tag of the contents that were read.
+	ETag string
+}
+
+// ObjectAckedFunc is called once all records read from an object are
+// acknowledged, i.e. once the object is processed.
+type ObjectAckedFunc func(ctx context.Context, o AckedObject) error
+
+// objectAckGroup returns the group tracking the records read from an object,
+// it is nil if nothing needs to happen once they are acknowledged.
+func (c ReaderConfig) objectAckGroup(bucket, key string, object *s3.GetObjectOutput) *ackGroup {
+	if c.ObjectAcked == nil {
+		return nil
+	}
+	o := AckedObject{
+		Bucket:    bucket,
+		Key:       key,
+		VersionID: aws.ToString(object.VersionId),
+		ETag:      aws.ToString(object.ETag),
+	}
+	return &ackGroup{acked: func(ctx context.Context) error {
+		return c.ObjectAcked(ctx, o)
+	}}
+}
+
+// bufferedRecord is a record waiting in an iterator's buffer together with
+// the function acknowledging it.
+type bufferedRecord struct {
+	record opencdc.Record
+	ack    ackFunc
+}
+
+// ackGroup tracks the records created from a single unit of work, e.g. an SQS
+// message or a scan of the bucket, acked is called once all of them are
+// acknowledged. A nil ackGroup doesn't track anything.
+type ackGroup struct {
+	acked func(ctx context.Context) error
+
+	m       sync.Mutex
+	pending int  // records that are not acknowledged yet
+	done    bool // all records were sent
+}
+
+// track registers a record created from the unit of work and returns the
+// function acknowledging it.
+func (g *ackGroup) track() ackFunc {
+	if g == nil {
+		return nil
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.pending++
+	return func(ctx context.Context) error {
+		g.m.Lock()
+		defer g.m.Unlock()
+		g.pending--
+		return g.ackedIfDone(ctx)
+	}
+}
+
+// sent marks that all records were created from the unit of work.
+func (g *ackGroup) sent(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.done = true
+	return g.ackedIfDone(ctx)
+}
+
+func (g *ackGroup) ackedIfDone(ctx context.Context) error {
+	if !g.done || g.pending > 0 {
+		return nil
+	}
+	return g.acked(ctx)
+}
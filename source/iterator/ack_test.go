@@ -0,0 +1,53 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/matryer/is"
+)
+
+func TestReaderConfig_ObjectAckGroup(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	var acked []AckedObject
+	c := ReaderConfig{ObjectAcked: func(_ context.Context, o AckedObject) error {
+		acked = append(acked, o)
+		return nil
+	}}
+	scan := &ackGroup{acked: func(context.Context) error { return nil }}
+	object := &s3.GetObjectOutput{VersionId: aws.String("v1"), ETag: aws.String(`"etag"`)}
+	group := c.objectAckGroup("bucket", "file.jsonl", object)
+
+	first := combineAcks(scan.track(), group.track())
+	second := combineAcks(scan.track(), group.track())
+	is.NoErr(group.sent(ctx))
+
+	// the object is acked once all of its records are acked
+	is.NoErr(second(ctx))
+	is.Equal(len(acked), 0)
+	is.NoErr(first(ctx))
+	is.Equal(acked, []AckedObject{{Bucket: "bucket", Key: "file.jsonl", VersionID: "v1", ETag: `"etag"`}})
+
+	// nothing is tracked without a callback
+	group = ReaderConfig{}.objectAckGroup("bucket", "file.jsonl", object)
+	is.True(group == nil)
+	is.True(combineAcks(group.track()) == nil)
+}
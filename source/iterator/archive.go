@@ -0,0 +1,85 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"io"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
+)
+
+// archiveRecordReader decodes the records contained in files written by the
+// S3 destination. The payload returned by Next is the payload of the decoded
+// record, the whole record is restored with restoreRecord.
+type archiveRecordReader struct {
+	body   io.ReadCloser
+	format format.Format
+	reader format.Reader
+	record opencdc.Record // last decoded record
+	row    int64
+}
+
+func newArchiveRecordReader(f format.Format, body io.ReadCloser) *archiveRecordReader {
+	return &archiveRecordReader{body: body, format: f}
+}
+
+func (r *archiveRecordReader) Next(context.Context) (opencdc.Data, int64, error) {
+	if r.reader == nil {
+		var err error
+		r.reader, err = r.format.NewReader(r.body)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	rec, err := r.reader.Next()
+	if err != nil {
+		return nil, 0, err
+	}
+	r.row++
+	r.record = rec
+	return rec.Payload.After, r.row, nil
+}
+
+func (r *archiveRecordReader) Close() error {
+	return r.body.Close()
+}
+
+// restoreRecord returns the record last decoded by reader if it decodes files
+// written by the S3 destination, the restored record keeps the position of r,
+// so the source can resume reading the file. Records containing a chunk of a
+// large object get the chunk's metadata, Parquet rows get the schema of the
+// file, other records are returned unchanged.
+func restoreRecord(reader recordReader, r opencdc.Record) opencdc.Record {
+	switch reader := reader.(type) {
+	case *archiveRecordReader:
+		restored := reader.record
+		restored.Position = r.Position
+		return restored
+	case *chunkRecordReader:
+		reader.chunkMetadata(r.Metadata)
+		return r
+	case *parquetRecordReader:
+		if reader.schema != nil {
+			r.Metadata.SetPayloadSchemaSubject(reader.schema.Subject)
+			r.Metadata.SetPayloadSchemaVersion(reader.schema.Version)
+		}
+		return r
+	default:
+		return r
+	}
+}
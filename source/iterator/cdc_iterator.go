@@ -15,55 +15,183 @@
 package iterator
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/conduitio/conduit-commons/opencdc"
 	"github.com/conduitio/conduit-connector-s3/source/position"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"gopkg.in/tomb.v2"
 )
 
+// CDCConfig configures how the CDC iterator detects changes.
+type CDCConfig struct {
+	PollingPeriod time.Duration
+	// Unversioned detects changes by comparing the objects listed by each
+	// scan to an index of the previous scan instead of listing object
+	// versions, for buckets without versioning.
+	Unversioned bool
+	// IndexDir is the directory the index is persisted in, the index is
+	// rebuilt after a restart if empty.
+	IndexDir string
+	// IndexMemoryLimit is the number of index entries kept in memory, larger
+	// indexes are spilled to a file.
+	IndexMemoryLimit int
+	// IncludeBefore attaches the previous object version as the before
+	// payload of updates and deletes, only versions up to BeforeMaxSize bytes
+	// are fetched.
+	IncludeBefore bool
+	BeforeMaxSize int64
+	// FetchConcurrency is the number of detected changes fetched in
+	// parallel, records are still returned in the order of the changes.
+	FetchConcurrency int
+	// BufferSize is the number of records buffered before they are read.
+	BufferSize int
+
+	// memory is the budget for bodies of changes read into memory before
+	// they are flushed, shared with the snapshot prefetchers. Changes are
+	// streamed once they are flushed if it is nil.
+	memory *memoryBudget
+}
+
 // CDCIterator scans the bucket periodically and detects changes made to it.
 type CDCIterator struct {
 	bucket       string
 	prefix       string
 	client       *s3.Client
-	buffer       chan opencdc.Record
+	buffer       chan bufferedRecord
 	ticker       *time.Ticker
-	lastModified time.Time
-	caches       chan []CacheEntry
+	caches       chan cdcScan
 	tomb         *tomb.Tomb
+	readerConfig ReaderConfig
+	cdcConfig    CDCConfig
+	// fetch fetches the objects of detected changes
+	fetch fetchFunc
+	// list lists the object versions of the bucket
+	list listVersionsFunc
+
+	// cursor points to the last change of the last acknowledged scan, only
+	// changes after it are detected, only accessed by startCDC
+	cursor cdcCursor
+	// lines of the object at the cursor that were read before the connector
+	// stopped, the rest of the object is read first
+	resumeLine int64
+	// committed is signaled once all records of a scan are acknowledged
+	committed chan struct{}
+
+	// the index of the objects found by the last scan, only used for
+	// buckets without versioning
+	indexStore *indexStore
+	indexMutex sync.Mutex
+	index      objectIndex
+	hasIndex   bool
+	// pending is the index of the last scan, it replaces index once all
+	// records of the scan are acknowledged
+	pending *objectIndex
+}
+
+// listVersionsFunc lists object versions.
+type listVersionsFunc func(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+
+// cdcScan contains the changes detected by a single scan.
+type cdcScan struct {
+	cache []CacheEntry
+	// group tracks the records built from the changes, it is nil if they
+	// don't need to be acknowledged
+	group *ackGroup
 }
 
 type CacheEntry struct {
 	key          string
+	versionID    string
 	operation    opencdc.Operation
 	lastModified time.Time
+	skipLines    int64
+
+	// the version before an update or delete, only set if it is attached to
+	// the record
+	previousVersionID *string
+	previousSize      int64
 }
 
-// NewCDCIterator returns a CDCIterator and starts the process of listening to changes every pollingPeriod.
+// cursor returns the position of the change in the order changes are read.
+func (e CacheEntry) cursor() cdcCursor {
+	return cdcCursor{lastModified: e.lastModified.Unix(), key: e.key, versionID: e.versionID}
+}
+
+// cdcCursor orders changes by their last modified time, with the second
+// precision of positions, then by key and version ID. Changes made in the same
+// second are thereby neither skipped nor read twice after a restart.
+type cdcCursor struct {
+	lastModified int64
+	key          string
+	versionID    string
+}
+
+func (c cdcCursor) less(other cdcCursor) bool {
+	if c.lastModified != other.lastModified {
+		return c.lastModified < other.lastModified
+	}
+	if c.key != other.key {
+		return c.key < other.key
+	}
+	return c.versionID < other.versionID
+}
+
+// cdcSettleTime is how long changes are held back after the second they were
+// made in, so no changes with the same second are made after the cursor
+// passed it. It allows for that much clock skew between the connector and S3.
+const cdcSettleTime = time.Second
+
+// NewCDCIterator returns a CDCIterator and starts the process of listening to changes every polling period.
+// Changes made after the position are detected, ordered by their last
+// modified time, key and version ID. If the position points to a line inside
+// an object, the rest of that object is read first.
+// For buckets without versioning, changes are detected by comparing each scan
+// to the persisted index, if there is no index, the first scan only detects
+// objects created or updated after the position timestamp.
 func NewCDCIterator(
 	bucket, prefix string,
-	pollingPeriod time.Duration,
+	cdcConfig CDCConfig,
+	readerConfig ReaderConfig,
 	client *s3.Client,
-	from time.Time,
+	from position.Position,
 ) (*CDCIterator, error) {
 	cdc := CDCIterator{
 		bucket:       bucket,
 		prefix:       prefix,
 		client:       client,
-		buffer:       make(chan opencdc.Record, 1),
-		caches:       make(chan []CacheEntry),
-		ticker:       time.NewTicker(pollingPeriod),
+		buffer:       make(chan bufferedRecord, max(cdcConfig.BufferSize, 1)),
+		caches:       make(chan cdcScan),
+		ticker:       time.NewTicker(cdcConfig.PollingPeriod),
 		tomb:         &tomb.Tomb{},
-		lastModified: from,
+		readerConfig: readerConfig,
+		cdcConfig:    cdcConfig,
+		committed:    make(chan struct{}, 1),
+	}
+	cdc.fetch = cdc.fetchS3Object
+	cdc.list = client.ListObjectVersions
+	cdc.cursor = cdcCursor{lastModified: from.Timestamp.Unix(), key: from.Key, versionID: from.VersionID}
+	cdc.resumeLine = from.Line
+	if cdcConfig.Unversioned {
+		var err error
+		cdc.indexStore, err = newIndexStore(cdcConfig.IndexDir, cdcConfig.IndexMemoryLimit, Location{Bucket: bucket, Prefix: prefix})
+		if err != nil {
+			return nil, err
+		}
+		cdc.index, cdc.hasIndex, err = cdc.indexStore.load()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// start listening to changes
@@ -78,15 +206,16 @@ func (w *CDCIterator) HasNext(_ context.Context) bool {
 	return len(w.buffer) > 0 || !w.tomb.Alive() // if tomb is dead we return true so caller will fetch error with Next
 }
 
-// Next returns the next record from the buffer.
-func (w *CDCIterator) Next(ctx context.Context) (opencdc.Record, error) {
+// Next returns the next record from the buffer and the function
+// acknowledging it.
+func (w *CDCIterator) Next(ctx context.Context) (opencdc.Record, ackFunc, error) {
 	select {
 	case r := <-w.buffer:
-		return r, nil
+		return r.record, r.ack, nil
 	case <-w.tomb.Dead():
-		return opencdc.Record{}, w.tomb.Err()
+		return opencdc.Record{}, nil, w.tomb.Err()
 	case <-ctx.Done():
-		return opencdc.Record{}, ctx.Err()
+		return opencdc.Record{}, nil, ctx.Err()
 	}
 }
 
@@ -97,9 +226,10 @@ func (w *CDCIterator) Stop() {
 }
 
 // startCDC scans the S3 bucket every polling period for changes
-// only detects the changes made after the w.lastModified
+// only detects the changes made after the w.cursor
 func (w *CDCIterator) startCDC() error {
 	defer close(w.caches)
+	defer w.removeIndexes()
 
 	// we initialize two caches that we reuse so we don't allocate a new one every time
 	cache := make([]CacheEntry, 0)
@@ -109,7 +239,16 @@ func (w *CDCIterator) startCDC() error {
 		case <-w.tomb.Dying():
 			return w.tomb.Err()
 		case <-w.ticker.C: // detect changes every polling period
-			err := w.populateCache(w.tomb.Context(nil), &cache, nil) //nolint:staticcheck // SA1012 tomb expects nil
+			ctx := w.tomb.Context(nil) //nolint:staticcheck // SA1012 tomb expects nil
+			var group *ackGroup
+			var err error
+			if w.indexStore != nil {
+				group, err = w.scanIndex(ctx, &cache)
+			} else {
+				settled := time.Now().Add(-cdcSettleTime)
+				err = w.populateCache(ctx, &cache, settled, nil)
+				group = &ackGroup{acked: w.scanAcked}
+			}
 			if err != nil {
 				return err
 			}
@@ -117,18 +256,29 @@ func (w *CDCIterator) startCDC() error {
 				continue
 			}
 			sort.Slice(cache, func(i, j int) bool {
-				return cache[i].lastModified.Before(cache[j].lastModified)
+				return cache[i].cursor().less(cache[j].cursor())
 			})
 
+			last := cache[len(cache)-1].cursor()
 			select {
-			case w.caches <- cache:
+			case w.caches <- cdcScan{cache: cache, group: group}:
 				// worked fine
-				w.lastModified = cache[len(cache)-1].lastModified
 				cache, nextCache = nextCache, cache // switch caches
 				cache = cache[:0]                   // empty cache
 			case <-w.tomb.Dying():
 				return w.tomb.Err()
 			}
+
+			// the next scan starts after this scan, or is compared to its
+			// index, once all of its changes are acknowledged, so changes
+			// that are not acknowledged are detected again after a restart
+			select {
+			case <-w.committed:
+				w.cursor = last
+				w.resumeLine = 0
+			case <-w.tomb.Dying():
+				return w.tomb.Err()
+			}
 		}
 	}
 }
@@ -141,109 +291,594 @@ func (w *CDCIterator) flush() error {
 		select {
 		case <-w.tomb.Dying():
 			return w.tomb.Err()
-		case cache := <-w.caches:
-			for _, entry := range cache {
-				output, err := w.buildRecord(entry)
-				if err != nil {
-					return fmt.Errorf("could not build record for %q: %w", entry.key, err)
-				}
-
-				select {
-				case w.buffer <- output:
-					// worked fine
-				case <-w.tomb.Dying():
-					return w.tomb.Err()
-				}
+		case scan := <-w.caches:
+			err := w.flushScan(scan)
+			if err != nil {
+				return err
+			}
+			err = scan.group.sent(w.tomb.Context(nil)) //nolint:staticcheck // SA1012 tomb expects nil
+			if err != nil {
+				return err
 			}
 		}
 	}
 }
 
-// getLatestObjects gets all the latest version of objects in S3 bucket
-func (w *CDCIterator) populateCache(ctx context.Context, cache *[]CacheEntry, keyMarker *string) error {
+// cdcFetch is a detected change that is fetched in the background.
+type cdcFetch struct {
+	entry CacheEntry
+	// done is closed once the change is fetched
+	done   chan struct{}
+	prev   *previousVersion
+	object *s3.GetObjectOutput
+	// reserved is the memory reserved for the body of the object
+	reserved int64
+	err      error
+}
+
+// flushScan fetches up to FetchConcurrency changes of the scan in parallel
+// and flushes them in the order they were detected. The fetches run in
+// goroutines managed by the tomb, so they are stopped with the iterator.
+func (w *CDCIterator) flushScan(scan cdcScan) error {
+	concurrency := max(w.cdcConfig.FetchConcurrency, 1)
+	// tokens limits the changes that are fetched or flushed at the same time
+	tokens := make(chan struct{}, concurrency)
+	fetches := make(chan *cdcFetch, concurrency)
+
+	w.tomb.Go(func() error {
+		defer close(fetches)
+		for _, entry := range scan.cache {
+			select {
+			case tokens <- struct{}{}:
+			case <-w.tomb.Dying():
+				return nil
+			}
+			f := &cdcFetch{entry: entry, done: make(chan struct{})}
+			fetches <- f // never blocks, there are as many slots as tokens
+			w.tomb.Go(func() error {
+				defer close(f.done)
+				f.prev, f.object, f.reserved, f.err = w.fetchEntry(entry)
+				return nil
+			})
+		}
+		return nil
+	})
+
+	for f := range fetches {
+		select {
+		case <-f.done:
+		case <-w.tomb.Dying():
+			return w.tomb.Err()
+		}
+		if f.err != nil {
+			return f.err
+		}
+		err := w.flushEntry(f.entry, f.prev, f.object, scan.group)
+		w.cdcConfig.memory.release(f.reserved)
+		if err != nil {
+			return err
+		}
+		<-tokens
+	}
+	return nil
+}
+
+// fetchEntry fetches the object and previous version of a detected change.
+// Bodies of objects that are read as a whole are read into memory if they fit
+// in the memory budget, so they are downloaded in parallel, other bodies are
+// streamed once the change is flushed. reserved is the memory reserved for
+// the body, it is released once the change is flushed.
+func (w *CDCIterator) fetchEntry(entry CacheEntry) (prev *previousVersion, object *s3.GetObjectOutput, reserved int64, err error) {
+	if entry.operation == opencdc.OperationDelete && w.readerConfig.Format != "" {
+		// the records in a deleted file were already read when the file was
+		// created
+		return nil, nil, 0, nil
+	}
+	prev, err = w.fetchPreviousVersion(entry)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if entry.operation == opencdc.OperationDelete {
+		return prev, nil, 0, nil
+	}
+
+	object, err = w.fetch(w.tomb.Context(nil), entry.key) //nolint:staticcheck // SA1012 tomb expects nil
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("could not fetch S3 object for %v: %w", entry.key, err)
+	}
+	size := aws.ToInt64(object.ContentLength)
+	if !w.readerConfig.readsWholeObject() ||
+		(w.readerConfig.MaxObjectSize > 0 && size > w.readerConfig.MaxObjectSize) ||
+		!w.cdcConfig.memory.reserve(size) {
+		return prev, object, 0, nil
+	}
+	defer object.Body.Close()
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		w.cdcConfig.memory.release(size)
+		return nil, nil, 0, fmt.Errorf("could not read %q: %w", entry.key, err)
+	}
+	object.Body = io.NopCloser(bytes.NewReader(body))
+	return prev, object, size, nil
+}
+
+// flushEntry builds the records for a fetched change and sends them to the
+// buffer, an object can produce multiple records if it is split into lines.
+// The records are tracked by group.
+func (w *CDCIterator) flushEntry(entry CacheEntry, prev *previousVersion, object *s3.GetObjectOutput, group *ackGroup) error {
+	if entry.operation == opencdc.OperationDelete {
+		if w.readerConfig.Format != "" {
+			return nil
+		}
+		r, err := w.buildRecord(entry, nil, prev, nil, 0)
+		if err != nil {
+			return fmt.Errorf("could not build record: %w", err)
+		}
+		return w.send(r, group.track())
+	}
+
+	ctx := w.tomb.Context(nil) //nolint:staticcheck // SA1012 tomb expects nil
+	reader, err := w.readerConfig.open(ctx, w.client, w.bucket, entry.key, object, entry.skipLines)
+	if errors.Is(err, errObjectSkipped) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	objectGroup := w.readerConfig.objectAckGroup(w.bucket, entry.key, object)
+
+	for {
+		payload, line, err := reader.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return objectGroup.sent(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %q: %w", entry.key, err)
+		}
+		if line > 0 && line <= entry.skipLines {
+			continue // already read before the connector stopped
+		}
+
+		r, err := w.buildRecord(entry, object, prev, payload, line)
+		if err != nil {
+			return fmt.Errorf("could not build record: %w", err)
+		}
+		err = w.send(restoreRecord(reader, r), combineAcks(group.track(), objectGroup.track()))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// send puts the record in the buffer, it returns an error if the tomb is dying.
+func (w *CDCIterator) send(r opencdc.Record, ack ackFunc) error {
+	select {
+	case w.buffer <- bufferedRecord{record: r, ack: ack}:
+		return nil
+	case <-w.tomb.Dying():
+		return w.tomb.Err()
+	}
+}
+
+// populateCache gets the latest versions of objects changed after the cursor,
+// changes made after the second before settled are left for the next scan.
+func (w *CDCIterator) populateCache(ctx context.Context, cache *[]CacheEntry, settled time.Time, keyMarker *string) error {
 	listObjectInput := &s3.ListObjectVersionsInput{ // default is 1000 keys max
 		Bucket:    aws.String(w.bucket),
 		Prefix:    aws.String(w.prefix),
 		KeyMarker: keyMarker,
 	}
-	objects, err := w.client.ListObjectVersions(ctx, listObjectInput)
+	objects, err := w.list(ctx, listObjectInput)
 	if err != nil {
 		return fmt.Errorf("couldn't get latest objects: %w", err)
 	}
 
 	updatedObjects := make(map[string]bool)
+	// the newest version of each object that is not the latest, versions of
+	// an object are listed from newest to oldest
+	previousVersions := make(map[string]types.ObjectVersion)
 
 	for _, v := range objects.Versions {
-		if *v.IsLatest && v.LastModified.After(w.lastModified) {
-			*cache = append(*cache, CacheEntry{key: *v.Key, lastModified: *v.LastModified, operation: opencdc.OperationCreate})
+		c := cdcCursor{lastModified: v.LastModified.Unix(), key: *v.Key, versionID: aws.ToString(v.VersionId)}
+		changed := *v.IsLatest && w.isChange(c, settled)
+		resumed := *v.IsLatest && w.isResumedObject(c)
+		if changed || resumed {
+			// skip filtered objects so they are never downloaded
+			ok, err := w.readerConfig.Filter.match(ctx, w.client, w.bucket, *v.Key, aws.ToInt64(v.Size), v.VersionId)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		entry := CacheEntry{key: c.key, versionID: c.versionID, lastModified: *v.LastModified, operation: opencdc.OperationCreate}
+		if changed {
+			*cache = append(*cache, entry)
+		} else if resumed {
+			entry.skipLines = w.resumeLine
+			*cache = append(*cache, entry)
 		} else {
 			// this is a version that is not the latest, this means this object
 			// was updated
 			updatedObjects[*v.Key] = true
+			if _, ok := previousVersions[*v.Key]; !ok && !*v.IsLatest {
+				previousVersions[*v.Key] = v
+			}
 		}
 	}
 	for i, entry := range *cache {
 		if updatedObjects[entry.key] {
 			entry.operation = opencdc.OperationUpdate
+			w.setPreviousVersion(&entry, previousVersions)
 			(*cache)[i] = entry
 		}
 	}
 
 	for _, v := range objects.DeleteMarkers {
-		if *v.IsLatest && v.LastModified.After(w.lastModified) {
-			*cache = append(*cache, CacheEntry{key: *v.Key, lastModified: *v.LastModified, operation: opencdc.OperationDelete})
+		// the size and content type of deleted objects are unknown
+		c := cdcCursor{lastModified: v.LastModified.Unix(), key: *v.Key, versionID: aws.ToString(v.VersionId)}
+		if *v.IsLatest && w.isChange(c, settled) && w.readerConfig.Filter.MatchKey(*v.Key) {
+			entry := CacheEntry{key: c.key, versionID: c.versionID, lastModified: *v.LastModified, operation: opencdc.OperationDelete}
+			w.setPreviousVersion(&entry, previousVersions)
+			*cache = append(*cache, entry)
 		}
 	}
 
 	if *objects.IsTruncated {
-		return w.populateCache(ctx, cache, objects.NextKeyMarker)
+		return w.populateCache(ctx, cache, settled, objects.NextKeyMarker)
 	}
 	return nil
 }
 
-func (w *CDCIterator) fetchS3Object(entry CacheEntry) (*s3.GetObjectOutput, []byte, error) {
-	object, err := w.client.GetObject(w.tomb.Context(nil), //nolint:staticcheck // SA1012 tomb expects nil
-		&s3.GetObjectInput{
-			Bucket: aws.String(w.bucket),
-			Key:    aws.String(entry.key),
-		})
+// scanIndex lists the objects of the location and compares them to the index
+// of the previous scan, which detects changes in buckets without versioning.
+// Created, updated and deleted objects are added to the cache. The returned
+// group replaces the index once all records built from the changes are
+// acknowledged, it is nil if there is nothing to wait for.
+func (w *CDCIterator) scanIndex(ctx context.Context, cache *[]CacheEntry) (*ackGroup, error) {
+	w.indexMutex.Lock()
+	index, hasIndex := w.index, w.hasIndex
+	w.indexMutex.Unlock()
+
+	prev, err := index.reader()
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not get S3 object: %w", err)
+		return nil, err
 	}
+	defer prev.Close()
 
-	rawBody, err := io.ReadAll(object.Body)
+	writer := w.indexStore.writer()
+	changed, err := w.diffIndex(ctx, prev, hasIndex, writer, cache)
+	if err != nil {
+		writer.Abort()
+		return nil, err
+	}
+	next, err := writer.Close()
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not read S3 object body: %w", err)
+		return nil, err
+	}
+	if !changed {
+		w.indexStore.remove(next)
+		return nil, nil
 	}
 
-	return object, rawBody, nil
+	w.indexMutex.Lock()
+	w.pending = &next
+	w.indexMutex.Unlock()
+	if len(*cache) == 0 {
+		// only filtered objects changed
+		return nil, w.commitIndex()
+	}
+	return &ackGroup{acked: func(ctx context.Context) error {
+		if err := w.commitIndex(); err != nil {
+			return err
+		}
+		return w.scanAcked(ctx)
+	}}, nil
 }
 
-// createRecord creates the record for the object fetched from S3 (for updates and inserts)
-func (w *CDCIterator) buildRecord(entry CacheEntry) (opencdc.Record, error) {
-	var object *s3.GetObjectOutput
-	var payload []byte
+// scanAcked signals startCDC that all records of the last scan are
+// acknowledged.
+func (w *CDCIterator) scanAcked(context.Context) error {
+	select {
+	case w.committed <- struct{}{}:
+	default:
+	}
+	return nil
+}
 
-	switch entry.operation {
-	case opencdc.OperationCreate, opencdc.OperationUpdate:
-		var err error
-		object, payload, err = w.fetchS3Object(entry)
+// diffIndex writes the listed objects to the writer and adds the changes
+// compared to the previous index to the cache. Both the listing and the index
+// are sorted by key, so they are compared without loading them into memory.
+// It returns true if the index changed.
+func (w *CDCIterator) diffIndex(
+	ctx context.Context,
+	prev *indexReader,
+	hasIndex bool,
+	writer *indexWriter,
+	cache *[]CacheEntry,
+) (bool, error) {
+	d := &indexDiff{w: w, prev: prev, scanStart: time.Now(), cache: cache}
+	if err := d.advance(); err != nil {
+		return false, err
+	}
+
+	var lastKey string
+	paginator := s3.NewListObjectsV2Paginator(w.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(w.bucket),
+		Prefix: aws.String(w.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return opencdc.Record{}, fmt.Errorf("could not fetch S3 object for %v: %w", entry.key, err)
+			return false, fmt.Errorf("couldn't list objects: %w", err)
+		}
+		for _, o := range page.Contents {
+			key := aws.ToString(o.Key)
+			if lastKey != "" && key <= lastKey {
+				return false, fmt.Errorf("objects are not listed in key order (%q after %q), which is required to detect changes without versioning", key, lastKey)
+			}
+			lastKey = key
+			if !w.readerConfig.Filter.MatchKey(key) {
+				continue
+			}
+			if err := d.removed(&key); err != nil {
+				return false, err
+			}
+			prevEntry, err := d.previous(key)
+			if err != nil {
+				return false, err
+			}
+			changed, err := w.diffObject(ctx, o, prevEntry, hasIndex, writer, cache)
+			if err != nil {
+				return false, err
+			}
+			d.changed = d.changed || changed
+		}
+	}
+	if err := d.removed(nil); err != nil {
+		return false, err
+	}
+	return d.changed, nil
+}
+
+// diffObject writes the listed object to the writer and adds it to the cache
+// if it changed compared to its entry in the previous index, prevEntry is nil
+// if the object is new. It returns true if the object changed.
+func (w *CDCIterator) diffObject(
+	ctx context.Context,
+	o types.Object,
+	prevEntry *indexEntry,
+	hasIndex bool,
+	writer *indexWriter,
+	cache *[]CacheEntry,
+) (bool, error) {
+	key := aws.ToString(o.Key)
+	entry := indexEntry{Key: key, ETag: aws.ToString(o.ETag), LastModified: aws.ToTime(o.LastModified)}
+	if prevEntry != nil && !entry.changed(*prevEntry) {
+		entry.Filtered = prevEntry.Filtered
+		return false, writer.Write(entry)
+	}
+
+	ok, err := w.readerConfig.Filter.match(ctx, w.client, w.bucket, key, aws.ToInt64(o.Size), nil)
+	if err != nil {
+		return false, err
+	}
+	entry.Filtered = !ok
+	if err := writer.Write(entry); err != nil {
+		return false, err
+	}
+	if !ok {
+		return true, nil
+	}
+
+	ce := CacheEntry{key: key, lastModified: entry.LastModified, operation: opencdc.OperationCreate}
+	if w.isResumedObject(ce.cursor()) {
+		ce.skipLines = w.resumeLine
+	}
+	switch {
+	case !hasIndex && !w.cursor.less(ce.cursor()) && ce.skipLines == 0:
+		// without a previous index only objects changed after the position
+		// are known to be changes
+		return true, nil
+	case prevEntry != nil && !prevEntry.Filtered:
+		ce.operation = opencdc.OperationUpdate
+	}
+	*cache = append(*cache, ce)
+	return true, nil
+}
+
+// indexDiff walks the previous index while it is compared to the listed
+// objects.
+type indexDiff struct {
+	w         *CDCIterator
+	prev      *indexReader
+	scanStart time.Time
+	cache     *[]CacheEntry
+
+	// old is the next entry of the previous index, nil at the end
+	old     *indexEntry
+	changed bool
+}
+
+func (d *indexDiff) advance() error {
+	e, err := d.prev.Next()
+	if errors.Is(err, io.EOF) {
+		d.old = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d.old = &e
+	return nil
+}
+
+// removed adds the deletes of the objects in the previous index sorted before
+// key, all remaining objects if key is nil.
+func (d *indexDiff) removed(key *string) error {
+	for d.old != nil && (key == nil || d.old.Key < *key) {
+		d.changed = true
+		// objects that were never read don't produce a delete
+		if !d.old.Filtered && d.w.readerConfig.Filter.MatchKey(d.old.Key) {
+			*d.cache = append(*d.cache, CacheEntry{key: d.old.Key, lastModified: d.scanStart, operation: opencdc.OperationDelete})
+		}
+		if err := d.advance(); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// previous returns the entry of the key in the previous index and advances
+// past it, it returns nil if the key is not in the previous index.
+func (d *indexDiff) previous(key string) (*indexEntry, error) {
+	if d.old == nil || d.old.Key != key {
+		return nil, nil
+	}
+	prevEntry := d.old
+	return prevEntry, d.advance()
+}
+
+// commitIndex replaces the index with the index of the last scan.
+func (w *CDCIterator) commitIndex() error {
+	w.indexMutex.Lock()
+	defer w.indexMutex.Unlock()
+	if w.pending == nil {
+		// the iterator was stopped
+		return nil
+	}
+	index, err := w.indexStore.replace(w.index, *w.pending)
+	w.pending = nil
+	if err != nil {
+		return err
+	}
+	w.index, w.hasIndex = index, true
+	return nil
+}
+
+// removeIndexes removes the index files that are not persisted once the
+// iterator stops.
+func (w *CDCIterator) removeIndexes() {
+	if w.indexStore == nil {
+		return
+	}
+	w.indexMutex.Lock()
+	defer w.indexMutex.Unlock()
+	if w.pending != nil {
+		w.indexStore.remove(*w.pending)
+		w.pending = nil
+	}
+	w.indexStore.remove(w.index)
+}
+
+// setPreviousVersion sets the version the entry changed, if the previous
+// version is attached to records.
+func (w *CDCIterator) setPreviousVersion(entry *CacheEntry, previousVersions map[string]types.ObjectVersion) {
+	v, ok := previousVersions[entry.key]
+	if !w.cdcConfig.IncludeBefore || !ok {
+		return
+	}
+	entry.previousVersionID = v.VersionId
+	entry.previousSize = aws.ToInt64(v.Size)
+}
+
+// previousVersion is the version of an object before it was updated or
+// deleted.
+type previousVersion struct {
+	body     opencdc.Data
+	metadata opencdc.Metadata
+}
+
+// fetchPreviousVersion returns the version the entry changed, it is nil if no
+// previous version is attached. The body of versions larger than the size
+// limit isn't fetched.
+func (w *CDCIterator) fetchPreviousVersion(entry CacheEntry) (*previousVersion, error) {
+	if entry.previousVersionID == nil {
+		return nil, nil
+	}
+	prev := &previousVersion{
+		metadata: opencdc.Metadata{
+			MetadataBeforePrefix + MetadataVersionID: aws.ToString(entry.previousVersionID),
+		},
+	}
+	if entry.previousSize > w.cdcConfig.BeforeMaxSize {
+		return prev, nil
+	}
+
+	ctx := w.tomb.Context(nil) //nolint:staticcheck // SA1012 tomb expects nil
+	object, err := w.client.GetObject(ctx,
+		&s3.GetObjectInput{
+			Bucket:    aws.String(w.bucket),
+			Key:       aws.String(entry.key),
+			VersionId: entry.previousVersionID,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("could not get the previous version of S3 object %v: %w", entry.key, err)
+	}
+	reader, err := openObject(w.readerConfig, entry.key, object)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	prev.body, _, err = reader.Next(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the previous version of %q: %w", entry.key, err)
+	}
+	for k, v := range objectMetadata(object, 0) {
+		prev.metadata[MetadataBeforePrefix+k] = v
+	}
+	return prev, nil
+}
+
+// isChange returns true if the change is after the cursor and was made in a
+// second that ended before settled.
+func (w *CDCIterator) isChange(c cdcCursor, settled time.Time) bool {
+	return w.cursor.less(c) && c.lastModified < settled.Unix()
+}
+
+// isResumedObject returns true if the object is the one that was partially
+// read when the connector stopped and it wasn't changed since.
+func (w *CDCIterator) isResumedObject(c cdcCursor) bool {
+	return w.resumeLine > 0 && c == w.cursor
+}
+
+func (w *CDCIterator) fetchS3Object(ctx context.Context, key string) (*s3.GetObjectOutput, error) {
+	object, err := w.client.GetObject(ctx,
+		&s3.GetObjectInput{
+			Bucket: aws.String(w.bucket),
+			Key:    aws.String(key),
+		})
+	if err != nil {
+		return nil, fmt.Errorf("could not get S3 object: %w", err)
+	}
+
+	return object, nil
+}
+
+// buildRecord creates the record for the object fetched from S3, object and
+// payload are nil for deletes. prev is the previous version attached to
+// updates and deletes, it is nil if it isn't attached.
+func (w *CDCIterator) buildRecord(entry CacheEntry, object *s3.GetObjectOutput, prev *previousVersion, payload opencdc.Data, line int64) (opencdc.Record, error) {
 	p := position.Position{
 		Key:       entry.key,
 		Timestamp: entry.lastModified,
 		Type:      position.TypeCDC,
+		Line:      line,
+		VersionID: entry.versionID,
 	}
 
 	m := opencdc.Metadata{}
 	if object != nil {
-		m[MetadataS3HeaderPrefix+MetadataContentType] = *object.ContentType
-		for key, val := range object.Metadata {
-			m[key] = val
+		m = objectMetadata(object, line)
+	}
+	var before opencdc.Data
+	if prev != nil {
+		before = prev.body
+		for k, v := range prev.metadata {
+			m[k] = v
 		}
 	}
 
@@ -252,21 +887,20 @@ func (w *CDCIterator) buildRecord(entry CacheEntry) (opencdc.Record, error) {
 		return sdk.Util.Source.NewRecordCreate(
 			p.ToRecordPosition(), m,
 			opencdc.RawData(entry.key),
-			opencdc.RawData(payload),
+			payload,
 		), nil
 	case opencdc.OperationUpdate:
-
 		return sdk.Util.Source.NewRecordUpdate(
 			p.ToRecordPosition(), m,
 			opencdc.RawData(entry.key),
-			nil, // TODO we could actually attach last version
-			opencdc.RawData(payload),
+			before,
+			payload,
 		), nil
 	case opencdc.OperationDelete:
 		return sdk.Util.Source.NewRecordDelete(
 			p.ToRecordPosition(), m,
 			opencdc.RawData(entry.key),
-			nil,
+			before,
 		), nil
 	}
 
@@ -0,0 +1,208 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+	"gopkg.in/tomb.v2"
+)
+
+func TestCDCCursor_Order(t *testing.T) {
+	is := is.New(t)
+	second := time.Unix(1700000000, 0)
+
+	entries := []CacheEntry{
+		{key: "b", versionID: "1", lastModified: second.Add(time.Second)},
+		{key: "b", versionID: "2", lastModified: second.Add(300 * time.Millisecond)},
+		{key: "c", versionID: "1", lastModified: second},
+		{key: "a", versionID: "1", lastModified: second.Add(900 * time.Millisecond)},
+		{key: "b", versionID: "1", lastModified: second.Add(100 * time.Millisecond)},
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].cursor().less(entries[j].cursor())
+	})
+
+	// changes in the same second are ordered by key and version ID
+	want := []cdcCursor{
+		{lastModified: second.Unix(), key: "a", versionID: "1"},
+		{lastModified: second.Unix(), key: "b", versionID: "1"},
+		{lastModified: second.Unix(), key: "b", versionID: "2"},
+		{lastModified: second.Unix(), key: "c", versionID: "1"},
+		{lastModified: second.Unix() + 1, key: "b", versionID: "1"},
+	}
+	for i, e := range entries {
+		is.Equal(e.cursor(), want[i])
+	}
+}
+
+func TestCDCIterator_IsChange(t *testing.T) {
+	second := time.Unix(1700000000, 0)
+	w := &CDCIterator{cursor: cdcCursor{lastModified: second.Unix(), key: "b", versionID: "2"}}
+	settled := second.Add(2 * time.Second)
+
+	testCases := []struct {
+		name   string
+		cursor cdcCursor
+		want   bool
+	}{
+		{name: "same second, lower key", cursor: cdcCursor{lastModified: second.Unix(), key: "a", versionID: "9"}, want: false},
+		{name: "same change", cursor: cdcCursor{lastModified: second.Unix(), key: "b", versionID: "2"}, want: false},
+		{name: "same second and key, higher version", cursor: cdcCursor{lastModified: second.Unix(), key: "b", versionID: "3"}, want: true},
+		{name: "same second, higher key", cursor: cdcCursor{lastModified: second.Unix(), key: "c", versionID: "1"}, want: true},
+		{name: "earlier second", cursor: cdcCursor{lastModified: second.Unix() - 1, key: "z", versionID: "1"}, want: false},
+		{name: "second not settled", cursor: cdcCursor{lastModified: settled.Unix(), key: "a", versionID: "1"}, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(w.isChange(tc.cursor, settled), tc.want)
+		})
+	}
+}
+
+func TestCDCIterator_FlushScanOrder(t *testing.T) {
+	is := is.New(t)
+	memory := newMemoryBudget(100)
+	w := &CDCIterator{
+		buffer:    make(chan bufferedRecord, 100),
+		tomb:      &tomb.Tomb{},
+		cdcConfig: CDCConfig{FetchConcurrency: 3, memory: memory},
+	}
+
+	var cache []CacheEntry
+	delays := make(map[string]time.Duration)
+	for i := range 10 {
+		key := fmt.Sprintf("file%02d", i)
+		cache = append(cache, CacheEntry{key: key, operation: opencdc.OperationCreate})
+		// later changes are fetched faster
+		delays[key] = time.Duration(10-i) * 5 * time.Millisecond
+	}
+	cache = append(cache, CacheEntry{key: "file10", operation: opencdc.OperationDelete})
+	w.fetch = func(ctx context.Context, key string) (*s3.GetObjectOutput, error) {
+		select {
+		case <-time.After(delays[key]):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		body := "body of " + key
+		return &s3.GetObjectOutput{
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: aws.Int64(int64(len(body))),
+		}, nil
+	}
+	w.tomb.Go(func() error {
+		return w.flushScan(cdcScan{cache: cache})
+	})
+	is.NoErr(w.tomb.Wait())
+
+	// changes are fetched in parallel but flushed in order
+	is.Equal(len(w.buffer), len(cache))
+	for _, entry := range cache {
+		r := <-w.buffer
+		is.Equal(r.record.Key, opencdc.RawData(entry.key))
+		is.Equal(r.record.Operation, entry.operation)
+		if entry.operation == opencdc.OperationCreate {
+			is.Equal(string(r.record.Payload.After.Bytes()), "body of "+entry.key)
+		}
+	}
+	// the memory of flushed changes is released
+	is.True(memory.reserve(100))
+}
+
+func TestCDCIterator_ResumeUnackedScan(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	modified := time.Now().Add(-time.Hour)
+	var m sync.Mutex
+	versions := []types.ObjectVersion{testObjectVersion("a", modified), testObjectVersion("b", modified.Add(time.Second))}
+	list := func(context.Context, *s3.ListObjectVersionsInput, ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+		m.Lock()
+		defer m.Unlock()
+		return &s3.ListObjectVersionsOutput{Versions: slices.Clone(versions), IsTruncated: aws.Bool(false)}, nil
+	}
+	start := func() *CDCIterator {
+		w := &CDCIterator{
+			buffer:    make(chan bufferedRecord, 10),
+			caches:    make(chan cdcScan),
+			ticker:    time.NewTicker(10 * time.Millisecond),
+			tomb:      &tomb.Tomb{},
+			cdcConfig: CDCConfig{FetchConcurrency: 1},
+			committed: make(chan struct{}, 1),
+			list:      list,
+			fetch: func(context.Context, string) (*s3.GetObjectOutput, error) {
+				return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("body"))}, nil
+			},
+		}
+		w.tomb.Go(w.startCDC)
+		w.tomb.Go(w.flush)
+		return w
+	}
+	next := func(w *CDCIterator) (string, ackFunc) {
+		r, ack, err := w.Next(ctx)
+		is.NoErr(err)
+		return string(r.Key.Bytes()), ack
+	}
+
+	// the connector stops before the scan is acknowledged
+	w := start()
+	a, _ := next(w)
+	b, _ := next(w)
+	is.Equal([]string{a, b}, []string{"a", "b"})
+	w.Stop()
+
+	// no record was acknowledged, so the scan is read again after a restart
+	w = start()
+	defer w.Stop()
+	a, ackA := next(w)
+	b, ackB := next(w)
+	is.Equal([]string{a, b}, []string{"a", "b"})
+
+	// the next scan waits until the scan is acknowledged
+	m.Lock()
+	versions = append(versions, testObjectVersion("c", modified.Add(2*time.Second)))
+	m.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	is.Equal(len(w.buffer), 0)
+
+	is.NoErr(ackA(ctx))
+	is.NoErr(ackB(ctx))
+	c, _ := next(w)
+	is.Equal(c, "c")
+}
+
+func testObjectVersion(key string, modified time.Time) types.ObjectVersion {
+	return types.ObjectVersion{
+		Key:          aws.String(key),
+		VersionId:    aws.String("1"),
+		LastModified: aws.Time(modified),
+		IsLatest:     aws.Bool(true),
+		Size:         aws.Int64(4),
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// LargeObjectPolicy defines what happens with objects larger than the
+// maximum object size.
+type LargeObjectPolicy string
+
+const (
+	// LargeObjectFail stops reading with an error.
+	LargeObjectFail LargeObjectPolicy = "fail"
+	// LargeObjectSkip skips the object.
+	LargeObjectSkip LargeObjectPolicy = "skip"
+	// LargeObjectSplit produces one record per chunk of the object.
+	LargeObjectSplit LargeObjectPolicy = "split"
+)
+
+const (
+	// MetadataChunkIndex is the metadata key containing the 0-based index of
+	// a chunk of a large object.
+	MetadataChunkIndex = "s3.chunk.index"
+	// MetadataChunkTotal is the metadata key containing the number of chunks
+	// of a large object.
+	MetadataChunkTotal = "s3.chunk.total"
+	// MetadataChunkOffset is the metadata key containing the byte offset of
+	// a chunk in a large object.
+	MetadataChunkOffset = "s3.chunk.offset"
+	// MetadataChunkETag is the metadata key containing the ETag of the large
+	// object a chunk belongs to.
+	MetadataChunkETag = "s3.chunk.etag"
+)
+
+// errObjectSkipped is returned when opening an object that is skipped because
+// it is larger than the maximum object size.
+var errObjectSkipped = errors.New("object skipped")
+
+// open returns a reader returning the payloads contained in the object, like
+// openObject, but applies the large object policy to objects larger than
+// MaxObjectSize. Large objects that are split are fetched in chunks, skip is
+// the number of chunks that were already read. The object's body is closed if
+// it isn't read.
+func (c ReaderConfig) open(
+	ctx context.Context,
+	client *s3.Client,
+	bucket, key string,
+	object *s3.GetObjectOutput,
+	skip int64,
+) (recordReader, error) {
+	size := aws.ToInt64(object.ContentLength)
+	if c.MaxObjectSize <= 0 || size <= c.MaxObjectSize {
+		return openObject(c, key, object)
+	}
+	// the body is not read, large objects are either skipped or fetched in
+	// chunks
+	_ = object.Body.Close()
+
+	switch c.LargeObjects {
+	case LargeObjectSkip:
+		sdk.Logger(ctx).Warn().
+			Str("bucket", bucket).
+			Str("key", key).
+			Int64("size", size).
+			Int64("maxObjectSize", c.MaxObjectSize).
+			Msg("skipping object larger than the maximum object size")
+		return nil, errObjectSkipped
+	case LargeObjectSplit:
+		return newChunkRecordReader(client, bucket, key, object, c.chunkSize(), skip), nil
+	default:
+		return nil, fmt.Errorf("object %q is larger than the maximum object size (%d > %d bytes)", key, size, c.MaxObjectSize)
+	}
+}
+
+func (c ReaderConfig) chunkSize() int64 {
+	if c.ChunkSize > 0 {
+		return c.ChunkSize
+	}
+	return c.MaxObjectSize
+}
+
+// chunkRecordReader returns a large object in chunks, each chunk is fetched
+// with a ranged GET. All chunks are fetched from the version that was opened,
+// or from the same contents if the bucket isn't versioned, so the chunks can
+// be reassembled into the original object. The chunks contain the object as
+// it is stored, it is not decompressed.
+type chunkRecordReader struct {
+	client *s3.Client
+	bucket string
+	key    string
+
+	versionID *string
+	etag      *string
+	size      int64
+	chunkSize int64
+
+	// index is the index of the next chunk
+	index int64
+}
+
+func newChunkRecordReader(
+	client *s3.Client,
+	bucket, key string,
+	object *s3.GetObjectOutput,
+	chunkSize, skip int64,
+) *chunkRecordReader {
+	return &chunkRecordReader{
+		client:    client,
+		bucket:    bucket,
+		key:       key,
+		versionID: object.VersionId,
+		etag:      object.ETag,
+		size:      aws.ToInt64(object.ContentLength),
+		chunkSize: chunkSize,
+		// chunks that were already read are not fetched again
+		index: skip,
+	}
+}
+
+// Next returns the next chunk, its line is the 1-based chunk number.
+func (r *chunkRecordReader) Next(ctx context.Context) (opencdc.Data, int64, error) {
+	if r.offset() >= r.size {
+		return nil, 0, io.EOF
+	}
+	chunk, err := r.fetchChunk(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.index++
+	return opencdc.RawData(chunk), r.index, nil
+}
+
+// fetchChunk fetches the next chunk with a ranged GET.
+func (r *chunkRecordReader) fetchChunk(ctx context.Context) ([]byte, error) {
+	offset := r.offset()
+	end := min(offset+r.chunkSize, r.size) - 1
+
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(r.bucket),
+		Key:       aws.String(r.key),
+		Range:     aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		VersionId: r.versionID,
+	}
+	if r.versionID == nil {
+		// make sure the object wasn't overwritten in the meantime
+		input.IfMatch = r.etag
+	}
+	object, err := r.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch chunk %d of %q: %w", r.index, r.key, err)
+	}
+	defer object.Body.Close()
+	chunk, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read chunk %d of %q: %w", r.index, r.key, err)
+	}
+	return chunk, nil
+}
+
+func (r *chunkRecordReader) Close() error {
+	return nil
+}
+
+// offset returns the offset of the next chunk.
+func (r *chunkRecordReader) offset() int64 {
+	return r.index * r.chunkSize
+}
+
+// total returns the number of chunks.
+func (r *chunkRecordReader) total() int64 {
+	return (r.size + r.chunkSize - 1) / r.chunkSize
+}
+
+// chunkMetadata replaces the line in the record's metadata with the metadata
+// describing the chunk that was returned last.
+func (r *chunkRecordReader) chunkMetadata(m opencdc.Metadata) {
+	index := r.index - 1
+	delete(m, MetadataLine)
+	m[MetadataChunkIndex] = strconv.FormatInt(index, 10)
+	m[MetadataChunkTotal] = strconv.FormatInt(r.total(), 10)
+	m[MetadataChunkOffset] = strconv.FormatInt(index*r.chunkSize, 10)
+	m[MetadataChunkETag] = aws.ToString(r.etag)
+}
@@ -0,0 +1,96 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func testObject(body string) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: aws.Int64(int64(len(body))),
+		ETag:          aws.String(`"etag"`),
+	}
+}
+
+func TestReaderConfig_Open(t *testing.T) {
+	ctx := context.Background()
+	body := "0123456789"
+
+	testCases := []struct {
+		name     string
+		policy   LargeObjectPolicy
+		maxSize  int64
+		wantErr  bool
+		wantSkip bool
+	}{
+		{name: "no limit", policy: LargeObjectFail, maxSize: 0},
+		{name: "within limit", policy: LargeObjectFail, maxSize: 10},
+		{name: "fail", policy: LargeObjectFail, maxSize: 9, wantErr: true},
+		{name: "skip", policy: LargeObjectSkip, maxSize: 9, wantErr: true, wantSkip: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			cfg := ReaderConfig{SplitMode: SplitModeObject, Compression: CompressionNone, MaxObjectSize: tc.maxSize, LargeObjects: tc.policy}
+
+			r, err := cfg.open(ctx, nil, "bucket", "file", testObject(body), 0)
+			is.Equal(err != nil, tc.wantErr)
+			is.Equal(errors.Is(err, errObjectSkipped), tc.wantSkip)
+			if err != nil {
+				return
+			}
+			payload, _, err := r.Next(ctx)
+			is.NoErr(err)
+			is.Equal(string(payload.Bytes()), body)
+		})
+	}
+}
+
+func TestReaderConfig_OpenSplit(t *testing.T) {
+	is := is.New(t)
+	cfg := ReaderConfig{MaxObjectSize: 5, LargeObjects: LargeObjectSplit, ChunkSize: 4}
+
+	// the first two chunks were already read
+	r, err := cfg.open(context.Background(), nil, "bucket", "file", testObject("0123456789"), 2)
+	is.NoErr(err)
+	chunks, ok := r.(*chunkRecordReader)
+	is.True(ok)
+	is.Equal(chunks.total(), int64(3))
+	is.Equal(chunks.offset(), int64(8))
+
+	// the metadata describes the chunk that was returned last
+	chunks.index = 3
+	r2 := restoreRecord(chunks, opencdc.Record{Metadata: opencdc.Metadata{MetadataLine: "3"}})
+	is.Equal(r2.Metadata, opencdc.Metadata{
+		MetadataChunkIndex:  "2",
+		MetadataChunkTotal:  "3",
+		MetadataChunkOffset: "8",
+		MetadataChunkETag:   `"etag"`,
+	})
+
+	_, _, err = chunks.Next(context.Background())
+	is.True(errors.Is(err, io.EOF))
+}
@@ -18,8 +18,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/conduitio/conduit-commons/opencdc"
 	"github.com/conduitio/conduit-connector-s3/source/position"
@@ -29,48 +31,83 @@ import (
 const (
 	MetadataS3HeaderPrefix = "s3.header."
 	MetadataContentType    = "contentType"
+	// MetadataBeforePrefix prefixes the metadata of the previous object
+	// version attached to updates and deletes.
+	MetadataBeforePrefix = "s3.before."
+	MetadataVersionID    = "versionId"
 )
 
+// objectMetadata returns the record metadata for an S3 object, line is added
+// if the object is split into lines.
+func objectMetadata(object *s3.GetObjectOutput, line int64) opencdc.Metadata {
+	m := opencdc.Metadata{
+		MetadataS3HeaderPrefix + MetadataContentType: aws.ToString(object.ContentType),
+	}
+	for key, val := range object.Metadata {
+		m[key] = val
+	}
+	if line > 0 {
+		m[MetadataLine] = strconv.FormatInt(line, 10)
+	}
+	return m
+}
+
 type CombinedIterator struct {
 	snapshotIterator *SnapshotIterator
 	cdcIterator      *CDCIterator
+	sqsIterator      *SQSIterator
 
-	bucket        string
-	prefix        string
-	pollingPeriod time.Duration
-	client        *s3.Client
+	bucket         string
+	prefix         string
+	snapshotConfig SnapshotConfig
+	cdcConfig      CDCConfig
+	readerConfig   ReaderConfig
+	client         *s3.Client
+	sqsConsumer    *SQSConsumer
+	cdcStart       time.Time
 }
 
 func NewCombinedIterator(
 	ctx context.Context,
 	bucket, prefix string,
-	pollingPeriod time.Duration,
+	snapshotConfig SnapshotConfig,
+	cdcConfig CDCConfig,
+	readerConfig ReaderConfig,
 	client *s3.Client,
+	sqsConsumer *SQSConsumer,
 	p position.Position,
 ) (*CombinedIterator, error) {
 	var err error
 	c := &CombinedIterator{
-		bucket:        bucket,
-		prefix:        prefix,
-		pollingPeriod: pollingPeriod,
-		client:        client,
+		bucket:         bucket,
+		prefix:         prefix,
+		snapshotConfig: snapshotConfig,
+		cdcConfig:      cdcConfig,
+		readerConfig:   readerConfig,
+		client:         client,
+		sqsConsumer:    sqsConsumer,
 	}
 
 	switch p.Type {
 	case position.TypeSnapshot:
 		if len(p.Key) != 0 {
 			sdk.Logger(ctx).
-				Warn().
+				Info().
 				Str("position", string(p.ToRecordPosition())).
-				Msg("previous snapshot did not complete successfully. snapshot will be restarted for consistency.")
+				Msg("previous snapshot did not complete, resuming snapshot after the last read key")
 		}
-		p = position.Position{} // always start snapshot from the beginning, so position is nil
-		c.snapshotIterator, err = NewSnapshotIterator(bucket, prefix, client, p)
+		c.snapshotIterator, err = NewSnapshotIterator(bucket, prefix, snapshotConfig, readerConfig, client, p)
 		if err != nil {
 			return nil, fmt.Errorf("could not create the snapshot iterator: %w", err)
 		}
 	case position.TypeCDC:
-		c.cdcIterator, err = NewCDCIterator(bucket, prefix, pollingPeriod, client, p.Timestamp)
+		if sqsConsumer != nil {
+			// unacknowledged messages are still in the queue, so there is
+			// nothing to resume
+			c.sqsIterator = sqsConsumer.Subscribe(Location{Bucket: bucket, Prefix: prefix})
+			break
+		}
+		c.cdcIterator, err = NewCDCIterator(bucket, prefix, cdcConfig, readerConfig, client, p)
 		if err != nil {
 			return nil, fmt.Errorf("could not create the CDC iterator: %w", err)
 		}
@@ -94,56 +131,87 @@ func (c *CombinedIterator) HasNext(ctx context.Context) bool {
 		return true
 	case c.cdcIterator != nil:
 		return c.cdcIterator.HasNext(ctx)
+	case c.sqsIterator != nil:
+		return c.sqsIterator.HasNext(ctx)
 	default:
 		return false
 	}
 }
 
 func (c *CombinedIterator) Next(ctx context.Context) (opencdc.Record, error) {
+	r, _, err := c.next(ctx)
+	return r, err
+}
+
+// next returns the next record and the function acknowledging it, the
+// function is nil if the record doesn't need to be acknowledged.
+func (c *CombinedIterator) next(ctx context.Context) (opencdc.Record, ackFunc, error) {
 	switch {
 	case c.snapshotIterator != nil:
-		r, err := c.snapshotIterator.Next(ctx)
+		r, ack, err := c.snapshotIterator.Next(ctx)
 		if err != nil {
-			return opencdc.Record{}, err
+			return opencdc.Record{}, nil, err
 		}
 		if !c.snapshotIterator.HasNext(ctx) {
 			// switch to cdc iterator
 			err := c.switchToCDCIterator()
 			if err != nil {
-				return opencdc.Record{}, err
-			}
-			// change the last record's position to CDC
-			r.Position, err = position.ConvertToCDCPosition(r.Position)
-			if err != nil {
-				return opencdc.Record{}, err
+				return opencdc.Record{}, nil, err
 			}
+			// change the last record's position to CDC, starting from where
+			// the CDC iterator starts detecting changes
+			r.Position = c.toCDCPosition()
 		}
-		return r, nil
+		return r, ack, nil
 
 	case c.cdcIterator != nil:
 		return c.cdcIterator.Next(ctx)
+	case c.sqsIterator != nil:
+		return c.sqsIterator.Next(ctx)
 	default:
-		return opencdc.Record{}, errors.New("no initialized iterator")
+		return opencdc.Record{}, nil, errors.New("no initialized iterator")
 	}
 }
 
 func (c *CombinedIterator) Stop() {
+	if c.snapshotIterator != nil {
+		c.snapshotIterator.Stop()
+	}
 	if c.cdcIterator != nil {
 		c.cdcIterator.Stop()
 	}
+	if c.sqsIterator != nil {
+		c.sqsIterator.Stop()
+	}
 }
 
 func (c *CombinedIterator) switchToCDCIterator() error {
 	var err error
-	timestamp := c.snapshotIterator.maxLastModified
-	// zero timestamp means nil position (empty bucket), so start detecting actions from now
-	if timestamp.IsZero() {
-		timestamp = time.Now()
+	c.cdcStart = c.snapshotIterator.cdcStart()
+	c.snapshotIterator.Stop()
+	if c.sqsConsumer != nil {
+		c.sqsIterator = c.sqsConsumer.Subscribe(Location{Bucket: c.bucket, Prefix: c.prefix})
+		c.snapshotIterator = nil
+		return nil
 	}
-	c.cdcIterator, err = NewCDCIterator(c.bucket, c.prefix, c.pollingPeriod, c.client, timestamp)
+	c.cdcIterator, err = NewCDCIterator(c.bucket, c.prefix, c.cdcConfig, c.readerConfig, c.client, position.Position{
+		Timestamp: c.cdcStart,
+		Type:      position.TypeCDC,
+	})
 	if err != nil {
 		return fmt.Errorf("could not create cdc iterator: %w", err)
 	}
 	c.snapshotIterator = nil
 	return nil
 }
+
+// toCDCPosition converts the position of the last snapshot record into a CDC
+// position pointing to the timestamp the CDC iterator started from. The
+// position doesn't contain a key, so all changes made in the second the CDC
+// iterator started are detected.
+func (c *CombinedIterator) toCDCPosition() opencdc.Position {
+	return position.Position{
+		Timestamp: c.cdcStart,
+		Type:      position.TypeCDC,
+	}.ToRecordPosition()
+}
@@ -0,0 +1,223 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression defines how object bodies are decompressed.
+type Compression string
+
+const (
+	// CompressionAuto detects the compression based on the object's
+	// Content-Encoding, content type or key extension, in that order.
+	CompressionAuto Compression = "auto"
+	// CompressionNone reads objects as they are stored.
+	CompressionNone  Compression = "none"
+	CompressionGzip  Compression = "gzip"
+	CompressionZstd  Compression = "zstd"
+	CompressionBzip2 Compression = "bzip2"
+	// CompressionSnappy is the snappy framing format.
+	CompressionSnappy Compression = "snappy"
+	// CompressionHadoopSnappy is the block format of Hadoop's SnappyCodec,
+	// used by Hadoop and Spark for ".snappy" files.
+	CompressionHadoopSnappy Compression = "hadoop-snappy"
+)
+
+// detectCompression returns the compression of an object based on its
+// Content-Encoding, content type or key extension.
+func detectCompression(key string, object *s3.GetObjectOutput) Compression {
+	switch strings.ToLower(aws.ToString(object.ContentEncoding)) {
+	case "gzip", "x-gzip":
+		return CompressionGzip
+	case "zstd":
+		return CompressionZstd
+	case "bzip2", "x-bzip2":
+		return CompressionBzip2
+	case "x-snappy-framed":
+		return CompressionSnappy
+	}
+
+	// ignore parameters like charset
+	contentType, _, _ := strings.Cut(aws.ToString(object.ContentType), ";")
+	switch strings.ToLower(strings.TrimSpace(contentType)) {
+	case "application/gzip", "application/x-gzip":
+		return CompressionGzip
+	case "application/zstd":
+		return CompressionZstd
+	case "application/x-bzip2":
+		return CompressionBzip2
+	case "application/x-snappy-framed":
+		return CompressionSnappy
+	}
+
+	switch strings.ToLower(path.Ext(key)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	case ".bz2":
+		return CompressionBzip2
+	case ".sz":
+		return CompressionSnappy
+	case ".snappy":
+		return CompressionHadoopSnappy
+	}
+	return CompressionNone
+}
+
+// decompress returns a body that decompresses the object's body, closing the
+// returned body closes the object's body.
+func decompress(c Compression, key string, object *s3.GetObjectOutput) (io.ReadCloser, error) {
+	if c == CompressionAuto || c == "" {
+		c = detectCompression(key, object)
+	}
+
+	body := object.Body
+	switch c {
+	case CompressionNone:
+		return body, nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("could not open gzip stream: %w", err)
+		}
+		return &decompressedBody{Reader: r, close: r.Close, body: body}, nil
+	case CompressionZstd:
+		r, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("could not open zstd stream: %w", err)
+		}
+		return &decompressedBody{Reader: r, close: func() error { r.Close(); return nil }, body: body}, nil
+	case CompressionBzip2:
+		return &decompressedBody{Reader: bzip2.NewReader(body), body: body}, nil
+	case CompressionSnappy:
+		return &decompressedBody{Reader: snappy.NewReader(body), body: body}, nil
+	case CompressionHadoopSnappy:
+		return &decompressedBody{Reader: &hadoopSnappyReader{r: body}, body: body}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", c)
+	}
+}
+
+// decompressedBody reads the decompressed body of an object.
+type decompressedBody struct {
+	io.Reader
+	close func() error // closes the decompressor, optional
+	body  io.ReadCloser
+}
+
+func (b *decompressedBody) Close() error {
+	var err error
+	if b.close != nil {
+		err = b.close()
+	}
+	if bodyErr := b.body.Close(); err == nil {
+		err = bodyErr
+	}
+	return err
+}
+
+// maxHadoopSnappyChunk is the size of the largest compressed chunk that is
+// read, Hadoop writes chunks of 256 KiB by default.
+const maxHadoopSnappyChunk = 64 << 20
+
+// hadoopSnappyReader decompresses the block format of Hadoop's SnappyCodec.
+// Each block starts with its uncompressed length, followed by chunks of
+// snappy compressed data, each prefixed with its compressed length. All
+// lengths are 4 byte big-endian integers.
+type hadoopSnappyReader struct {
+	r io.Reader
+	// remaining is the uncompressed length of the current block that was not
+	// decompressed yet
+	remaining int64
+	buf       bytes.Reader
+}
+
+func (h *hadoopSnappyReader) Read(p []byte) (int, error) {
+	for h.buf.Len() == 0 {
+		if err := h.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return h.buf.Read(p)
+}
+
+// nextChunk decompresses the next chunk into the buffer, it returns io.EOF
+// once all blocks are read.
+func (h *hadoopSnappyReader) nextChunk() error {
+	if h.remaining == 0 {
+		n, err := h.readLength()
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("could not read hadoop snappy block: %w", err)
+		}
+		h.remaining = n
+		if n == 0 {
+			return nil
+		}
+	}
+
+	n, err := h.readLength()
+	if errors.Is(err, io.EOF) {
+		// a block can't end before its uncompressed length is reached
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return fmt.Errorf("could not read hadoop snappy chunk: %w", err)
+	}
+	if n > maxHadoopSnappyChunk {
+		return fmt.Errorf("hadoop snappy chunk of %d bytes exceeds the maximum of %d bytes", n, maxHadoopSnappyChunk)
+	}
+	chunk := make([]byte, n)
+	if _, err := io.ReadFull(h.r, chunk); err != nil {
+		return fmt.Errorf("could not read hadoop snappy chunk: %w", err)
+	}
+	decoded, err := snappy.Decode(nil, chunk)
+	if err != nil {
+		return fmt.Errorf("could not decompress hadoop snappy chunk: %w", err)
+	}
+	if int64(len(decoded)) > h.remaining {
+		return errors.New("hadoop snappy chunk exceeds the length of its block")
+	}
+	h.remaining -= int64(len(decoded))
+	h.buf.Reset(decoded)
+	return nil
+}
+
+// readLength reads a 4 byte big-endian length.
+func (h *hadoopSnappyReader) readLength() (int64, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(h.r, b[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint32(b[:])), nil
+}
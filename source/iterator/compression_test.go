@@ -0,0 +1,179 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/matryer/is"
+)
+
+func TestDetectCompression(t *testing.T) {
+	testCases := []struct {
+		name            string
+		key             string
+		contentEncoding string
+		contentType     string
+		want            Compression
+	}{
+		{name: "plain", key: "file.json", want: CompressionNone},
+		{name: "gzip extension", key: "logs/file.json.gz", want: CompressionGzip},
+		{name: "zstd extension", key: "file.ZST", want: CompressionZstd},
+		{name: "bzip2 extension", key: "file.csv.bz2", want: CompressionBzip2},
+		{name: "snappy extension", key: "file.sz", want: CompressionSnappy},
+		{name: "hadoop snappy extension", key: "part-00000.snappy", want: CompressionHadoopSnappy},
+		{name: "snappy content type", key: "file", contentType: "application/x-snappy-framed", want: CompressionSnappy},
+		{name: "content encoding", key: "file.json", contentEncoding: "gzip", want: CompressionGzip},
+		{name: "content type", key: "file", contentType: "application/zstd", want: CompressionZstd},
+		{name: "content encoding before extension", key: "file.gz", contentEncoding: "zstd", want: CompressionZstd},
+		{name: "unknown content encoding", key: "file.bz2", contentEncoding: "identity", want: CompressionBzip2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			object := &s3.GetObjectOutput{}
+			if tc.contentEncoding != "" {
+				object.ContentEncoding = aws.String(tc.contentEncoding)
+			}
+			if tc.contentType != "" {
+				object.ContentType = aws.String(tc.contentType)
+			}
+			is.Equal(detectCompression(tc.key, object), tc.want)
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	content := []byte("line 1\nline 2\n")
+	compress := map[Compression]func(w io.Writer) io.WriteCloser{
+		CompressionGzip: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		CompressionZstd: func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+		CompressionSnappy:       func(w io.Writer) io.WriteCloser { return snappy.NewBufferedWriter(w) },
+		CompressionHadoopSnappy: func(w io.Writer) io.WriteCloser { return &hadoopSnappyWriter{w: w} },
+	}
+
+	for c, newWriter := range compress {
+		t.Run(string(c), func(t *testing.T) {
+			is := is.New(t)
+			var buf bytes.Buffer
+			w := newWriter(&buf)
+			_, err := w.Write(content)
+			is.NoErr(err)
+			is.NoErr(w.Close())
+
+			// the compression is configured explicitly, the key doesn't matter
+			object := &s3.GetObjectOutput{Body: io.NopCloser(&buf)}
+			body, err := decompress(c, "file", object)
+			is.NoErr(err)
+			got, err := io.ReadAll(body)
+			is.NoErr(err)
+			is.NoErr(body.Close())
+			is.Equal(got, content)
+		})
+	}
+}
+
+// hadoopSnappyWriter writes a block in the format of Hadoop's SnappyCodec
+// on close, splitting the data into chunks of 4 bytes.
+type hadoopSnappyWriter struct {
+	w    io.Writer
+	data []byte
+}
+
+func (h *hadoopSnappyWriter) Write(p []byte) (int, error) {
+	h.data = append(h.data, p...)
+	return len(p), nil
+}
+
+func (h *hadoopSnappyWriter) Close() error {
+	block := binary.BigEndian.AppendUint32(nil, uint32(len(h.data))) //nolint:gosec // test data is small
+	for data := h.data; len(data) > 0; {
+		n := min(len(data), 4)
+		chunk := snappy.Encode(nil, data[:n])
+		block = binary.BigEndian.AppendUint32(block, uint32(len(chunk))) //nolint:gosec // test data is small
+		block = append(block, chunk...)
+		data = data[n:]
+	}
+	_, err := h.w.Write(block)
+	return err
+}
+
+func TestDecompress_HadoopSnappyTruncated(t *testing.T) {
+	is := is.New(t)
+	var buf bytes.Buffer
+	w := &hadoopSnappyWriter{w: &buf}
+	_, err := w.Write([]byte("line 1\n"))
+	is.NoErr(err)
+	is.NoErr(w.Close())
+
+	object := &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))}
+	body, err := decompress(CompressionHadoopSnappy, "file", object)
+	is.NoErr(err)
+	_, err = io.ReadAll(body)
+	is.True(err != nil)
+}
+
+func TestOpenObject_Bzip2(t *testing.T) {
+	is := is.New(t)
+	f, err := os.Open("fixtures/lines.txt.bz2")
+	is.NoErr(err)
+
+	object := &s3.GetObjectOutput{Body: f}
+	r, err := openObject(ReaderConfig{SplitMode: SplitModeNewline, Compression: CompressionAuto}, "lines.txt.bz2", object)
+	is.NoErr(err)
+	defer r.Close()
+
+	for i, want := range []string{"line 1", "line 2"} {
+		payload, line, err := r.Next(context.Background())
+		is.NoErr(err)
+		is.Equal(string(payload.Bytes()), want)
+		is.Equal(line, int64(i+1))
+	}
+	_, _, err = r.Next(context.Background())
+	is.Equal(err, io.EOF)
+}
+
+func TestOpenObject_Gzip(t *testing.T) {
+	is := is.New(t)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte("a\nb\n"))
+	is.NoErr(err)
+	is.NoErr(w.Close())
+
+	object := &s3.GetObjectOutput{Body: io.NopCloser(&buf)}
+	r, err := openObject(ReaderConfig{SplitMode: SplitModeNewline, Compression: CompressionAuto}, "file.txt.gz", object)
+	is.NoErr(err)
+	defer r.Close()
+
+	payload, line, err := r.Next(context.Background())
+	is.NoErr(err)
+	is.Equal(string(payload.Bytes()), "a")
+	is.Equal(line, int64(1))
+}
@@ -0,0 +1,227 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+)
+
+// CSVColumnType is the type a CSV column value is converted to.
+type CSVColumnType string
+
+const (
+	CSVColumnTypeString CSVColumnType = "string"
+	CSVColumnTypeInt    CSVColumnType = "int"
+	CSVColumnTypeFloat  CSVColumnType = "float"
+	CSVColumnTypeBool   CSVColumnType = "bool"
+)
+
+// ParseCSVColumnType parses a column type, it returns an error if the type is
+// not supported.
+func ParseCSVColumnType(s string) (CSVColumnType, error) {
+	switch t := CSVColumnType(s); t {
+	case CSVColumnTypeString, CSVColumnTypeInt, CSVColumnTypeFloat, CSVColumnTypeBool:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unsupported CSV column type %q", s)
+	}
+}
+
+// CSVOptions configures how CSV objects are parsed.
+type CSVOptions struct {
+	// Delimiter separates fields in a row.
+	Delimiter rune
+	// Quote is used to quote fields containing delimiters, quotes or line
+	// breaks, a quote inside a quoted field is escaped by doubling it.
+	Quote rune
+	// Header is true if the first row contains the column names.
+	Header bool
+	// Columns contains the column names used when there is no header row.
+	Columns []string
+	// ColumnTypes maps column names to types, columns without a type are
+	// kept as strings.
+	ColumnTypes map[string]CSVColumnType
+}
+
+// csvRecordReader returns each CSV row as a structured payload keyed by the
+// column names.
+type csvRecordReader struct {
+	body    io.ReadCloser
+	parser  *csvParser
+	opts    CSVOptions
+	columns []string
+	row     int64
+}
+
+func newCSVRecordReader(opts CSVOptions, body io.ReadCloser) *csvRecordReader {
+	return &csvRecordReader{
+		body:    body,
+		parser:  &csvParser{reader: bufio.NewReader(body), delimiter: opts.Delimiter, quote: opts.Quote},
+		opts:    opts,
+		columns: opts.Columns,
+	}
+}
+
+func (r *csvRecordReader) Next(context.Context) (opencdc.Data, int64, error) {
+	if r.row == 0 && r.opts.Header {
+		header, err := r.readRow()
+		if err != nil {
+			return nil, 0, err
+		}
+		r.columns = header
+	}
+
+	fields, err := r.readRow()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data := make(opencdc.StructuredData, len(fields))
+	for i, field := range fields {
+		column := r.column(i)
+		value, err := r.convert(column, field)
+		if err != nil {
+			return nil, 0, fmt.Errorf("row %d: %w", r.row, err)
+		}
+		data[column] = value
+	}
+	return data, r.row, nil
+}
+
+// readRow reads the next non-empty row.
+func (r *csvRecordReader) readRow() ([]string, error) {
+	for {
+		fields, err := r.parser.readRow()
+		if err != nil {
+			return nil, err
+		}
+		r.row++
+		if len(fields) == 1 && fields[0] == "" {
+			continue // empty line
+		}
+		return fields, nil
+	}
+}
+
+func (r *csvRecordReader) column(i int) string {
+	if i < len(r.columns) {
+		return r.columns[i]
+	}
+	return "column" + strconv.Itoa(i+1)
+}
+
+func (r *csvRecordReader) convert(column, value string) (any, error) {
+	t, ok := r.opts.ColumnTypes[column]
+	if !ok || t == CSVColumnTypeString {
+		return value, nil
+	}
+	if value == "" {
+		return nil, nil //nolint:nilnil // empty values of typed columns are null
+	}
+
+	var v any
+	var err error
+	switch t {
+	case CSVColumnTypeInt:
+		v, err = strconv.ParseInt(value, 10, 64)
+	case CSVColumnTypeFloat:
+		v, err = strconv.ParseFloat(value, 64)
+	case CSVColumnTypeBool:
+		v, err = strconv.ParseBool(value)
+	default:
+		return nil, fmt.Errorf("unsupported CSV column type %q", t)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not convert column %q value %q to %s: %w", column, value, t, err)
+	}
+	return v, nil
+}
+
+func (r *csvRecordReader) Close() error {
+	return r.body.Close()
+}
+
+// csvParser reads CSV rows with a configurable delimiter and quote character,
+// which encoding/csv doesn't support.
+type csvParser struct {
+	reader    *bufio.Reader
+	delimiter rune
+	quote     rune
+}
+
+// readRow returns the fields of the next row, or io.EOF if there are no
+// more rows.
+func (p *csvParser) readRow() ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	quoted := false // inside a quoted field
+	read := false   // at least one rune was read
+
+	for {
+		c, _, err := p.reader.ReadRune()
+		if errors.Is(err, io.EOF) {
+			if !read {
+				return nil, io.EOF
+			}
+			if quoted {
+				return nil, errors.New("unexpected end of object in quoted field")
+			}
+			return append(fields, field.String()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		read = true
+
+		if quoted {
+			if c != p.quote {
+				field.WriteRune(c)
+				continue
+			}
+			next, _, err := p.reader.ReadRune()
+			if err == nil && next == p.quote {
+				field.WriteRune(p.quote) // escaped quote
+				continue
+			}
+			if err == nil {
+				_ = p.reader.UnreadRune()
+			}
+			quoted = false
+			continue
+		}
+
+		switch c {
+		case p.quote:
+			quoted = true
+		case p.delimiter:
+			fields = append(fields, field.String())
+			field.Reset()
+		case '\r':
+			// ignore carriage return in line endings
+		case '\n':
+			return append(fields, field.String()), nil
+		default:
+			field.WriteRune(c)
+		}
+	}
+}
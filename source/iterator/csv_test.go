@@ -0,0 +1,101 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func TestCSVRecordReader(t *testing.T) {
+	type row struct {
+		data opencdc.StructuredData
+		row  int64
+	}
+
+	testCases := []struct {
+		name string
+		opts CSVOptions
+		in   string
+		want []row
+	}{{
+		name: "header and types",
+		opts: CSVOptions{
+			Delimiter: ',',
+			Quote:     '"',
+			Header:    true,
+			ColumnTypes: map[string]CSVColumnType{
+				"id":     CSVColumnTypeInt,
+				"price":  CSVColumnTypeFloat,
+				"active": CSVColumnTypeBool,
+			},
+		},
+		in: "id,name,price,active\r\n1,\"Doe, John\",1.5,true\n\n2,\"say \"\"hi\"\"\",,false\n",
+		want: []row{
+			{data: opencdc.StructuredData{"id": int64(1), "name": "Doe, John", "price": 1.5, "active": true}, row: 2},
+			{data: opencdc.StructuredData{"id": int64(2), "name": `say "hi"`, "price": nil, "active": false}, row: 4},
+		},
+	}, {
+		name: "custom delimiter and quote without header",
+		opts: CSVOptions{
+			Delimiter: ';',
+			Quote:     '\'',
+			Columns:   []string{"a"},
+		},
+		in: "'x;y';z\n'multi\nline';w",
+		want: []row{
+			{data: opencdc.StructuredData{"a": "x;y", "column2": "z"}, row: 1},
+			{data: opencdc.StructuredData{"a": "multi\nline", "column2": "w"}, row: 2},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			r := newCSVRecordReader(tc.opts, io.NopCloser(strings.NewReader(tc.in)))
+
+			var got []row
+			for {
+				data, n, err := r.Next(context.Background())
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				is.NoErr(err)
+				got = append(got, row{data: data.(opencdc.StructuredData), row: n})
+			}
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestCSVRecordReader_InvalidValue(t *testing.T) {
+	is := is.New(t)
+	opts := CSVOptions{
+		Delimiter:   ',',
+		Quote:       '"',
+		Header:      true,
+		ColumnTypes: map[string]CSVColumnType{"id": CSVColumnTypeInt},
+	}
+	r := newCSVRecordReader(opts, io.NopCloser(strings.NewReader("id\nabc\n")))
+
+	_, _, err := r.Next(context.Background())
+	is.True(err != nil)
+}
@@ -0,0 +1,179 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// patternPrefixRegex marks a pattern as a regular expression.
+	patternPrefixRegex = "regex:"
+	// patternPrefixGlob marks a pattern as a glob, patterns without a prefix
+	// are globs too.
+	patternPrefixGlob = "glob:"
+)
+
+// ObjectFilter decides which objects are read, objects that don't match are
+// skipped before they are downloaded. The zero value matches all objects.
+type ObjectFilter struct {
+	// Include contains patterns of which at least one needs to match the
+	// key, all keys are included if empty.
+	Include []*regexp.Regexp
+	// Exclude contains patterns of which none may match the key.
+	Exclude []*regexp.Regexp
+	// MinSize is the minimum object size in bytes.
+	MinSize int64
+	// MaxSize is the maximum object size in bytes, 0 means no limit.
+	MaxSize int64
+	// ContentTypes contains the allowed content types, a type can end with
+	// "/*" to allow all subtypes (e.g. "text/*"). All content types are
+	// allowed if empty. Content types are not returned when listing
+	// objects, so checking them requires a HEAD request per object.
+	ContentTypes []string
+}
+
+// ParsePattern parses a key pattern. Patterns prefixed with "regex:" are
+// regular expressions, all other patterns are globs, optionally prefixed with
+// "glob:". In globs "*" matches any characters except "/", "**" matches any
+// characters including "/", "?" matches a single character except "/" and
+// "[...]" matches a character class.
+func ParsePattern(s string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(s, patternPrefixRegex); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", expr, err)
+		}
+		return re, nil
+	}
+	glob := strings.TrimPrefix(s, patternPrefixGlob)
+	re, err := regexp.Compile(globToRegexp(glob))
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	return re, nil
+}
+
+// globToRegexp converts a glob into a regular expression matching whole keys.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// MatchKey returns true if the key matches the include and exclude patterns.
+func (f ObjectFilter) MatchKey(key string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, key) {
+		return false
+	}
+	return !matchAny(f.Exclude, key)
+}
+
+// MatchSize returns true if the size is within the configured limits.
+func (f ObjectFilter) MatchSize(size int64) bool {
+	return size >= f.MinSize && (f.MaxSize == 0 || size <= f.MaxSize)
+}
+
+// MatchContentType returns true if the content type is allowed.
+func (f ObjectFilter) MatchContentType(contentType string) bool {
+	if len(f.ContentTypes) == 0 {
+		return true
+	}
+	// ignore parameters like charset
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, ct := range f.ContentTypes {
+		ct = strings.ToLower(ct)
+		if prefix, ok := strings.CutSuffix(ct, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true if the listed object matches the filter, the content
+// type is fetched with a HEAD request only if the key and size match and
+// content types are configured.
+func (f ObjectFilter) match(ctx context.Context, client *s3.Client, bucket, key string, size int64, versionID *string) (bool, error) {
+	if !f.MatchKey(key) || !f.MatchSize(size) {
+		return false, nil
+	}
+	if len(f.ContentTypes) == 0 {
+		return true, nil
+	}
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: versionID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not fetch the content type of %q: %w", key, err)
+	}
+	return f.MatchContentType(aws.ToString(head.ContentType)), nil
+}
+
+func matchAny(patterns []*regexp.Regexp, key string) bool {
+	for _, p := range patterns {
+		if p.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParsePattern(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{{
+		pattern: "*.json",
+		match:   []string{"a.json", ".json"},
+		noMatch: []string{"dir/a.json", "a.jsonl"},
+	}, {
+		pattern: "**/*.tmp",
+		match:   []string{"a.tmp", "dir/a.tmp", "dir/sub/a.tmp"},
+		noMatch: []string{"a.tmp.gz"},
+	}, {
+		pattern: "logs/**",
+		match:   []string{"logs/a", "logs/2024/01/a.gz"},
+		noMatch: []string{"other/logs/a"},
+	}, {
+		pattern: "**/",
+		match:   []string{"dir/", "dir/sub/"},
+		noMatch: []string{"dir/a"},
+	}, {
+		pattern: "glob:data-?[0-9].csv",
+		match:   []string{"data-a1.csv"},
+		noMatch: []string{"data-/1.csv", "data-ab.csv"},
+	}, {
+		pattern: "file[!0-9]",
+		match:   []string{"filea"},
+		noMatch: []string{"file1"},
+	}, {
+		pattern: "regex:_SUCCESS$",
+		match:   []string{"_SUCCESS", "out/_SUCCESS"},
+		noMatch: []string{"_SUCCESS.txt"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			is := is.New(t)
+			re, err := ParsePattern(tc.pattern)
+			is.NoErr(err)
+			for _, key := range tc.match {
+				is.True(re.MatchString(key)) // expected key to match
+			}
+			for _, key := range tc.noMatch {
+				is.True(!re.MatchString(key)) // expected key not to match
+			}
+		})
+	}
+}
+
+func TestParsePattern_InvalidRegex(t *testing.T) {
+	is := is.New(t)
+	_, err := ParsePattern("regex:(")
+	is.True(err != nil)
+}
+
+func TestObjectFilter(t *testing.T) {
+	is := is.New(t)
+	f := ObjectFilter{
+		Include:      []*regexp.Regexp{regexp.MustCompile(globToRegexp("data/**"))},
+		Exclude:      []*regexp.Regexp{regexp.MustCompile(globToRegexp("**/*.tmp"))},
+		MinSize:      1,
+		MaxSize:      100,
+		ContentTypes: []string{"application/json", "text/*"},
+	}
+
+	is.True(f.MatchKey("data/a.json"))
+	is.True(!f.MatchKey("data/a.tmp"))
+	is.True(!f.MatchKey("other/a.json"))
+
+	is.True(!f.MatchSize(0))
+	is.True(f.MatchSize(100))
+	is.True(!f.MatchSize(101))
+
+	is.True(f.MatchContentType("application/json; charset=utf-8"))
+	is.True(f.MatchContentType("text/csv"))
+	is.True(!f.MatchContentType("application/octet-stream"))
+
+	// the zero value matches everything
+	is.True(ObjectFilter{}.MatchKey("any"))
+	is.True(ObjectFilter{}.MatchSize(1 << 40))
+	is.True(ObjectFilter{}.MatchContentType(""))
+}
@@ -0,0 +1,272 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// indexEntry is an object found when scanning a location.
+type indexEntry struct {
+	Key          string    `json:"key"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+	// Filtered is true if the object didn't match the size or content type
+	// filter, so its changes are not read.
+	Filtered bool `json:"filtered,omitempty"`
+}
+
+// changed returns true if the entries point to different object contents.
+func (e indexEntry) changed(other indexEntry) bool {
+	return e.ETag != other.ETag || !e.LastModified.Equal(other.LastModified)
+}
+
+// objectIndex contains the objects found by a scan of a location, sorted by
+// key. Small indexes are kept in memory, larger ones are spilled to a file
+// containing one JSON encoded entry per line.
+type objectIndex struct {
+	// entries contains the objects if the index is not spilled
+	entries []indexEntry
+	// path is the file containing the objects, it is set if the index is
+	// spilled or persisted
+	path    string
+	spilled bool
+}
+
+// reader returns a reader returning the entries in key order.
+func (i objectIndex) reader() (*indexReader, error) {
+	if !i.spilled {
+		return &indexReader{entries: i.entries}, nil
+	}
+	f, err := os.Open(i.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %w", err)
+	}
+	return &indexReader{file: f, dec: json.NewDecoder(bufio.NewReader(f))}, nil
+}
+
+// indexReader reads the entries of an objectIndex.
+type indexReader struct {
+	entries []indexEntry
+	file    *os.File
+	dec     *json.Decoder
+}
+
+// Next returns the next entry, or io.EOF if there are no more entries.
+func (r *indexReader) Next() (indexEntry, error) {
+	if r.dec == nil {
+		if len(r.entries) == 0 {
+			return indexEntry{}, io.EOF
+		}
+		e := r.entries[0]
+		r.entries = r.entries[1:]
+		return e, nil
+	}
+	var e indexEntry
+	err := r.dec.Decode(&e)
+	if errors.Is(err, io.EOF) {
+		return indexEntry{}, io.EOF
+	}
+	if err != nil {
+		return indexEntry{}, fmt.Errorf("could not read index: %w", err)
+	}
+	return e, nil
+}
+
+func (r *indexReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// indexWriter builds an objectIndex from entries written in key order, the
+// entries are spilled to a temporary file in dir once there are more than
+// memoryLimit of them.
+type indexWriter struct {
+	dir         string
+	memoryLimit int
+
+	entries []indexEntry
+	file    *os.File
+	buf     *bufio.Writer
+	enc     *json.Encoder
+}
+
+func newIndexWriter(dir string, memoryLimit int) *indexWriter {
+	return &indexWriter{dir: dir, memoryLimit: memoryLimit}
+}
+
+// Write adds the entry to the index.
+func (w *indexWriter) Write(e indexEntry) error {
+	if w.file == nil && len(w.entries) < w.memoryLimit {
+		w.entries = append(w.entries, e)
+		return nil
+	}
+	if w.file == nil {
+		if err := w.spill(); err != nil {
+			return err
+		}
+	}
+	if err := w.enc.Encode(e); err != nil {
+		return fmt.Errorf("could not write index: %w", err)
+	}
+	return nil
+}
+
+// spill moves the entries kept in memory to a temporary file.
+func (w *indexWriter) spill() error {
+	f, err := os.CreateTemp(w.dir, "s3-index-*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create index file: %w", err)
+	}
+	w.file = f
+	w.buf = bufio.NewWriter(f)
+	w.enc = json.NewEncoder(w.buf)
+	for _, e := range w.entries {
+		if err := w.enc.Encode(e); err != nil {
+			return fmt.Errorf("could not write index: %w", err)
+		}
+	}
+	w.entries = nil
+	return nil
+}
+
+// Close returns the written index.
+func (w *indexWriter) Close() (objectIndex, error) {
+	if w.file == nil {
+		return objectIndex{entries: w.entries}, nil
+	}
+	err := w.buf.Flush()
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(w.file.Name())
+		return objectIndex{}, fmt.Errorf("could not write index: %w", err)
+	}
+	return objectIndex{path: w.file.Name(), spilled: true}, nil
+}
+
+// Abort discards the written entries.
+func (w *indexWriter) Abort() {
+	if w.file != nil {
+		_ = w.file.Close()
+		_ = os.Remove(w.file.Name())
+	}
+}
+
+// indexStore keeps the index of a location between scans. If the store has a
+// directory the index is persisted there, so it survives restarts.
+type indexStore struct {
+	// dir is the directory the index is persisted in, empty if the index is
+	// not persisted
+	dir string
+	// path is the file the index is persisted in
+	path        string
+	memoryLimit int
+}
+
+func newIndexStore(dir string, memoryLimit int, l Location) (*indexStore, error) {
+	s := &indexStore{dir: dir, memoryLimit: memoryLimit}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, fmt.Errorf("could not create index directory: %w", err)
+		}
+		// the collection can contain characters that are not allowed in
+		// file names
+		s.path = filepath.Join(dir, fmt.Sprintf("%x.index", sha256.Sum256([]byte(l.Collection()))))
+	}
+	return s, nil
+}
+
+// load returns the persisted index, ok is false if there is none.
+func (s *indexStore) load() (index objectIndex, ok bool, err error) {
+	if s.path == "" {
+		return objectIndex{}, false, nil
+	}
+	_, err = os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return objectIndex{}, false, nil
+	}
+	if err != nil {
+		return objectIndex{}, false, fmt.Errorf("could not open index: %w", err)
+	}
+	return objectIndex{path: s.path, spilled: true}, true, nil
+}
+
+// writer returns a writer for the index of the next scan.
+func (s *indexStore) writer() *indexWriter {
+	dir := s.dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return newIndexWriter(dir, s.memoryLimit)
+}
+
+// replace makes next the current index, persisting it if the store has a
+// directory, and removes the files of the previous index that are not
+// needed anymore.
+func (s *indexStore) replace(current, next objectIndex) (objectIndex, error) {
+	if s.path == "" {
+		s.remove(current)
+		return next, nil
+	}
+
+	if !next.spilled {
+		// small indexes are kept in memory, but still need to be persisted
+		w := newIndexWriter(s.dir, 0)
+		if err := w.spill(); err != nil {
+			w.Abort()
+			return objectIndex{}, err
+		}
+		for _, e := range next.entries {
+			if err := w.Write(e); err != nil {
+				w.Abort()
+				return objectIndex{}, err
+			}
+		}
+		written, err := w.Close()
+		if err != nil {
+			return objectIndex{}, err
+		}
+		next.path = written.path
+	}
+	// the rename replaces the previous index atomically
+	if err := os.Rename(next.path, s.path); err != nil {
+		_ = os.Remove(next.path)
+		return objectIndex{}, fmt.Errorf("could not persist index: %w", err)
+	}
+	next.path = s.path
+	return next, nil
+}
+
+// remove deletes the file of an index if it is not the persisted index.
+func (s *indexStore) remove(index objectIndex) {
+	if index.path != "" && index.path != s.path {
+		_ = os.Remove(index.path)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func testIndexEntries(n int) []indexEntry {
+	entries := make([]indexEntry, n)
+	for i := range entries {
+		entries[i] = indexEntry{
+			Key:          fmt.Sprintf("file%04d", i),
+			ETag:         fmt.Sprintf("\"etag%d\"", i),
+			LastModified: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+			Filtered:     i%2 == 0,
+		}
+	}
+	return entries
+}
+
+func writeIndex(t *testing.T, w *indexWriter, entries []indexEntry) objectIndex {
+	is := is.New(t)
+	for _, e := range entries {
+		is.NoErr(w.Write(e))
+	}
+	index, err := w.Close()
+	is.NoErr(err)
+	return index
+}
+
+func readIndex(t *testing.T, index objectIndex) []indexEntry {
+	is := is.New(t)
+	r, err := index.reader()
+	is.NoErr(err)
+	defer r.Close()
+
+	entries := make([]indexEntry, 0)
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		}
+		is.NoErr(err)
+		entries = append(entries, e)
+	}
+}
+
+func TestIndexWriter(t *testing.T) {
+	testCases := []struct {
+		name        string
+		entries     int
+		memoryLimit int
+		wantSpilled bool
+	}{
+		{name: "in memory", entries: 3, memoryLimit: 3, wantSpilled: false},
+		{name: "spilled", entries: 10, memoryLimit: 3, wantSpilled: true},
+		{name: "no memory", entries: 2, memoryLimit: 0, wantSpilled: true},
+		{name: "empty", entries: 0, memoryLimit: 3, wantSpilled: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			entries := testIndexEntries(tc.entries)
+
+			index := writeIndex(t, newIndexWriter(t.TempDir(), tc.memoryLimit), entries)
+			is.Equal(index.spilled, tc.wantSpilled)
+			is.Equal(readIndex(t, index), entries)
+		})
+	}
+}
+
+func TestIndexWriter_Abort(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	w := newIndexWriter(dir, 1)
+	for _, e := range testIndexEntries(3) {
+		is.NoErr(w.Write(e))
+	}
+	w.Abort()
+
+	files, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 0)
+}
+
+func TestIndexStore_Persisted(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	location := Location{Bucket: "bucket", Prefix: "logs/"}
+
+	s, err := newIndexStore(dir, 2, location)
+	is.NoErr(err)
+	_, ok, err := s.load()
+	is.NoErr(err)
+	is.True(!ok) // nothing persisted yet
+
+	// an index kept in memory is persisted as well
+	small := testIndexEntries(2)
+	current, err := s.replace(objectIndex{}, writeIndex(t, s.writer(), small))
+	is.NoErr(err)
+	is.Equal(current.path, s.path)
+	is.Equal(readIndex(t, current), small)
+
+	// a spilled index replaces the persisted one
+	large := testIndexEntries(5)
+	current, err = s.replace(current, writeIndex(t, s.writer(), large))
+	is.NoErr(err)
+	is.Equal(readIndex(t, current), large)
+
+	files, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 1) // only the persisted index is left
+
+	// the index is loaded after a restart
+	s, err = newIndexStore(dir, 2, location)
+	is.NoErr(err)
+	loaded, ok, err := s.load()
+	is.NoErr(err)
+	is.True(ok)
+	is.Equal(readIndex(t, loaded), large)
+
+	// other locations have their own index
+	other, err := newIndexStore(dir, 2, Location{Bucket: "bucket", Prefix: "events/"})
+	is.NoErr(err)
+	_, ok, err = other.load()
+	is.NoErr(err)
+	is.True(!ok)
+}
+
+func TestIndexStore_NotPersisted(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	s, err := newIndexStore("", 2, Location{Bucket: "bucket"})
+	is.NoErr(err)
+	w := s.writer()
+	w.dir = dir // keep spilled files in the test directory
+
+	first, err := s.replace(objectIndex{}, writeIndex(t, w, testIndexEntries(5)))
+	is.NoErr(err)
+	is.True(first.spilled)
+
+	second, err := s.replace(first, objectIndex{entries: testIndexEntries(1)})
+	is.NoErr(err)
+	is.Equal(readIndex(t, second), testIndexEntries(1))
+
+	// the spilled file of the replaced index is removed
+	files, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 0)
+}
@@ -0,0 +1,212 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/source/position"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// Location is a bucket and prefix pair read by the source.
+type Location struct {
+	Bucket string
+	Prefix string
+}
+
+// Collection returns the name identifying the location, it is used as the
+// collection of the records read from the location and to track the
+// location's position.
+func (l Location) Collection() string {
+	if l.Prefix == "" {
+		return l.Bucket
+	}
+	return l.Bucket + "/" + l.Prefix
+}
+
+// MultiIterator reads multiple locations, each location is read by its own
+// CombinedIterator and has its own snapshot and CDC progress. Locations take
+// turns in returning records.
+type MultiIterator struct {
+	locations []Location
+	iterators []*CombinedIterator
+	positions position.Positions
+
+	// current is the index of the iterator returning the next record, -1 if
+	// HasNext wasn't called yet
+	current int
+	// next is the index of the iterator that is checked first for the next
+	// record
+	next int
+
+	// acks contains the records that were returned but not acknowledged
+	// yet, in the order they were returned, acks are received concurrently
+	// to reads
+	acks      []pendingAck
+	acksMutex sync.Mutex
+}
+
+type pendingAck struct {
+	position opencdc.Position
+	ack      ackFunc
+}
+
+// NewMultiIterator returns an iterator reading the locations starting from
+// the record position. The record position contains the position of each
+// location, a position of a single location is used for the first location.
+// Snapshots fetch objects as configured by snapshotConfig. Changes are
+// detected by consuming the SQS queue if sqsConsumer is not nil, otherwise by
+// listing the locations as configured by cdcConfig.
+func NewMultiIterator(
+	ctx context.Context,
+	locations []Location,
+	snapshotConfig SnapshotConfig,
+	cdcConfig CDCConfig,
+	readerConfig ReaderConfig,
+	client *s3.Client,
+	sqsConsumer *SQSConsumer,
+	rp opencdc.Position,
+) (*MultiIterator, error) {
+	if len(locations) == 0 {
+		return nil, errors.New("no locations to read")
+	}
+	positions, err := position.ParseRecordPositions(rp, locations[0].Collection())
+	if err != nil {
+		return nil, err
+	}
+
+	// object bodies read into memory ahead of time count against a single
+	// budget
+	memory := newMemoryBudget(snapshotConfig.PrefetchMemoryLimit)
+	snapshotConfig.memory = memory
+	cdcConfig.memory = memory
+
+	m := &MultiIterator{
+		locations: locations,
+		iterators: make([]*CombinedIterator, 0, len(locations)),
+		positions: make(position.Positions, len(locations)),
+		current:   -1,
+	}
+	for _, l := range locations {
+		// locations without a position start with a snapshot
+		p := positions[l.Collection()]
+		it, err := NewCombinedIterator(ctx, l.Bucket, l.Prefix, snapshotConfig, cdcConfig, readerConfig, client, sqsConsumer, p)
+		if err != nil {
+			m.Stop()
+			return nil, fmt.Errorf("could not create the iterator for %q: %w", l.Collection(), err)
+		}
+		m.iterators = append(m.iterators, it)
+		m.positions[l.Collection()] = p
+	}
+	return m, nil
+}
+
+// HasNext returns true if any of the locations has a record to return.
+func (m *MultiIterator) HasNext(ctx context.Context) bool {
+	if m.current >= 0 {
+		return true
+	}
+	for i := range m.iterators {
+		idx := (m.next + i) % len(m.iterators)
+		if m.iterators[idx].HasNext(ctx) {
+			m.current = idx
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the next record, the record position contains the progress
+// of all locations.
+func (m *MultiIterator) Next(ctx context.Context) (opencdc.Record, error) {
+	if !m.HasNext(ctx) {
+		return opencdc.Record{}, sdk.ErrBackoffRetry
+	}
+	idx := m.current
+	m.current = -1
+	m.next = (idx + 1) % len(m.iterators)
+
+	r, ack, err := m.iterators[idx].next(ctx)
+	if err != nil {
+		return opencdc.Record{}, err
+	}
+
+	collection := m.locations[idx].Collection()
+	p, err := position.ParseRecordPosition(r.Position)
+	if err != nil {
+		return opencdc.Record{}, err
+	}
+	m.positions[collection] = p
+	if len(m.iterators) > 1 {
+		// a single location keeps the position format of a single location
+		r.Position = m.positions.ToRecordPosition()
+	}
+
+	if r.Metadata == nil {
+		r.Metadata = opencdc.Metadata{}
+	}
+	// records restored from files written by the destination keep their
+	// original collection
+	if _, ok := r.Metadata[opencdc.MetadataCollection]; !ok {
+		r.Metadata.SetCollection(collection)
+	}
+
+	m.acksMutex.Lock()
+	m.acks = append(m.acks, pendingAck{position: r.Position, ack: ack})
+	m.acksMutex.Unlock()
+	return r, nil
+}
+
+// Ack acknowledges the oldest record that wasn't acknowledged yet, records
+// are acknowledged in the order they were returned. The record is
+// acknowledged even if the actions tied to the acknowledgment fail.
+func (m *MultiIterator) Ack(ctx context.Context, p opencdc.Position) error {
+	m.acksMutex.Lock()
+	defer m.acksMutex.Unlock()
+
+	if len(m.acks) == 0 {
+		return fmt.Errorf("unexpected ack for position %q, no records are waiting for an ack", p)
+	}
+	pending := m.acks[0]
+	if !bytes.Equal(pending.position, p) {
+		return fmt.Errorf("unexpected ack for position %q, expected position %q", p, pending.position)
+	}
+	m.acks = m.acks[1:]
+	if pending.ack == nil {
+		return nil
+	}
+	return pending.ack(ctx)
+}
+
+// InFlight returns the number of records that were returned but not
+// acknowledged yet.
+func (m *MultiIterator) InFlight() int {
+	m.acksMutex.Lock()
+	defer m.acksMutex.Unlock()
+	return len(m.acks)
+}
+
+func (m *MultiIterator) Stop() {
+	for _, it := range m.iterators {
+		it.Stop()
+	}
+}
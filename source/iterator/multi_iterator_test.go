@@ -0,0 +1,41 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func TestMultiIterator_AckOrder(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	m := &MultiIterator{acks: []pendingAck{
+		{position: opencdc.Position("first")},
+		{position: opencdc.Position("second")},
+	}}
+	is.Equal(m.InFlight(), 2)
+
+	// records are acked in the order they were read
+	is.True(m.Ack(ctx, opencdc.Position("second")) != nil)
+	is.Equal(m.InFlight(), 2)
+
+	is.NoErr(m.Ack(ctx, opencdc.Position("first")))
+	is.Equal(m.InFlight(), 1)
+}
@@ -0,0 +1,369 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	sdkschema "github.com/conduitio/conduit-connector-sdk/schema"
+	"github.com/hamba/avro/v2"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/schema"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+// parquetBatchSize is the number of rows read from a Parquet object at once.
+const parquetBatchSize = 100
+
+// parquetRecordReader returns each row of a Parquet object as a structured
+// payload keyed by the column names. The schema of the file is converted to
+// an Avro schema and registered with the object's key as subject.
+type parquetRecordReader struct {
+	key    string
+	body   io.ReadCloser
+	reader *reader.ParquetReader
+	// schema is the registered schema of the rows, nil if the Parquet schema
+	// can't be converted
+	schema *sdkschema.Schema
+	rows   []any
+	read   int64 // number of rows read from the parquet reader
+	row    int64 // number of rows returned
+}
+
+func newParquetRecordReader(key string, body io.ReadCloser) *parquetRecordReader {
+	return &parquetRecordReader{key: key, body: body}
+}
+
+func (r *parquetRecordReader) Next(ctx context.Context) (opencdc.Data, int64, error) {
+	if r.reader == nil {
+		// parquet needs random access to the file, so the whole object is
+		// loaded into memory
+		data, err := io.ReadAll(r.body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not read the object's body: %w", err)
+		}
+		r.reader, err = reader.NewParquetReader(format.NewParquetBuffer(data), nil, 1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not open parquet file: %w", err)
+		}
+		if err := r.registerSchema(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if len(r.rows) == 0 {
+		remaining := r.reader.GetNumRows() - r.read
+		if remaining <= 0 {
+			return nil, 0, io.EOF
+		}
+		n := min(remaining, parquetBatchSize)
+		rows, err := r.reader.ReadByNumber(int(n))
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not read parquet rows: %w", err)
+		}
+		if len(rows) == 0 {
+			return nil, 0, io.EOF
+		}
+		r.rows = rows
+		r.read += int64(len(rows))
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	r.row++
+
+	sh := r.reader.SchemaHandler
+	v := parquetValue(sh, reflect.ValueOf(row), sh.GetRootInName())
+	data, ok := v.(map[string]any)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected parquet row type %T", v)
+	}
+	return opencdc.StructuredData(data), r.row, nil
+}
+
+// registerSchema registers the Avro schema of the rows, files with a schema
+// that can't be converted to Avro (e.g. columns with names that aren't valid
+// Avro names) are read without a schema.
+func (r *parquetRecordReader) registerSchema(ctx context.Context) error {
+	s, err := parquetAvroSchema(r.reader.SchemaHandler)
+	if err != nil {
+		sdk.Logger(ctx).Warn().Err(err).Str("key", r.key).Msg("could not convert the Parquet schema to Avro, rows are read without a schema")
+		return nil
+	}
+	registered, err := sdkschema.Create(ctx, sdkschema.TypeAvro, r.key, []byte(s.String()))
+	if err != nil {
+		return fmt.Errorf("could not register the schema of %q: %w", r.key, err)
+	}
+	r.schema = &registered
+	return nil
+}
+
+func (r *parquetRecordReader) Close() error {
+	if r.reader != nil {
+		r.reader.ReadStop()
+	}
+	return r.body.Close()
+}
+
+// parquetValue converts a value read by the parquet reader into a value that
+// can be used in structured data. Structs read by the reader use internal
+// field names, path is the internal path of the value in the schema and is
+// used to look up the original column names and logical types.
+func parquetValue(sh *schema.SchemaHandler, v reflect.Value, path string) any {
+	switch v.Kind() { //nolint:exhaustive // remaining kinds are primitives
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return parquetValue(sh, v.Elem(), path)
+	case reflect.Struct:
+		m := make(map[string]any, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			fieldPath := common.PathToStr([]string{path, v.Type().Field(i).Name})
+			m[parquetColumnName(sh, fieldPath)] = parquetValue(sh, v.Field(i), fieldPath)
+		}
+		return m
+	case reflect.Slice:
+		elemPath := path
+		if el := parquetSchemaElement(sh, path); el != nil && el.ConvertedType != nil && *el.ConvertedType == parquet.ConvertedType_LIST {
+			elemPath = common.PathToStr([]string{path, "List", "Element"})
+		}
+		s := make([]any, v.Len())
+		for i := range s {
+			s[i] = parquetValue(sh, v.Index(i), elemPath)
+		}
+		return s
+	case reflect.Map:
+		keyPath := common.PathToStr([]string{path, "Key_value", "Key"})
+		valuePath := common.PathToStr([]string{path, "Key_value", "Value"})
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(parquetValue(sh, iter.Key(), keyPath))
+			m[key] = parquetValue(sh, iter.Value(), valuePath)
+		}
+		return m
+	default:
+		return parquetPrimitive(parquetSchemaElement(sh, path), v.Interface())
+	}
+}
+
+// parquetPrimitive converts primitive values based on their logical type,
+// e.g. timestamps are returned as time.Time.
+func parquetPrimitive(el *parquet.SchemaElement, v any) any {
+	if el == nil {
+		return v
+	}
+	switch val := v.(type) {
+	case string:
+		switch {
+		case el.GetType() == parquet.Type_INT96:
+			return types.INT96ToTime(val).UTC()
+		case el.GetType() == parquet.Type_FIXED_LEN_BYTE_ARRAY:
+			return []byte(val)
+		case el.ConvertedType != nil, el.LogicalType != nil:
+			return val // UTF8, ENUM, JSON, DECIMAL etc.
+		default:
+			return []byte(val)
+		}
+	case int32:
+		if el.ConvertedType != nil && *el.ConvertedType == parquet.ConvertedType_DATE {
+			return time.Unix(int64(val)*24*60*60, 0).UTC()
+		}
+	case int64:
+		if lt := el.GetLogicalType(); lt != nil && lt.IsSetTIMESTAMP() {
+			unit := lt.GetTIMESTAMP().GetUnit()
+			utc := lt.GetTIMESTAMP().GetIsAdjustedToUTC()
+			switch {
+			case unit.IsSetMILLIS():
+				return types.TIMESTAMP_MILLISToTime(val, utc).UTC()
+			case unit.IsSetMICROS():
+				return types.TIMESTAMP_MICROSToTime(val, utc).UTC()
+			case unit.IsSetNANOS():
+				return types.TIMESTAMP_NANOSToTime(val, utc).UTC()
+			}
+		}
+		if el.ConvertedType != nil {
+			switch *el.ConvertedType { //nolint:exhaustive // other converted types keep the raw value
+			case parquet.ConvertedType_TIMESTAMP_MILLIS:
+				return types.TIMESTAMP_MILLISToTime(val, true).UTC()
+			case parquet.ConvertedType_TIMESTAMP_MICROS:
+				return types.TIMESTAMP_MICROSToTime(val, true).UTC()
+			}
+		}
+	}
+	return v
+}
+
+// parquetAvroSchema converts the schema of a Parquet file to the Avro schema
+// of the payloads returned by parquetValue.
+func parquetAvroSchema(sh *schema.SchemaHandler) (avro.Schema, error) {
+	if len(sh.SchemaElements) == 0 {
+		return nil, errors.New("empty schema")
+	}
+	s, _, err := parquetAvroType(sh, 0, "")
+	return s, err
+}
+
+// parquetAvroType returns the Avro type of the schema element with index i and
+// the index of the element following it and its children. Records are named
+// after their column, with the names of their parents as namespace.
+func parquetAvroType(sh *schema.SchemaHandler, i int, namespace string) (avro.Schema, int, error) {
+	el := sh.SchemaElements[i]
+	name := "record"
+	if i > 0 {
+		name = sh.Infos[i].ExName
+	}
+
+	var (
+		t    avro.Schema
+		next int
+		err  error
+	)
+	switch {
+	case el.GetNumChildren() == 0:
+		t, next = parquetAvroPrimitive(el), i+1
+	case el.GetConvertedType() == parquet.ConvertedType_LIST && el.GetNumChildren() == 1:
+		// the list group contains a repeated group containing the element
+		var items avro.Schema
+		if items, next, err = parquetAvroType(sh, i+2, namespace); err == nil {
+			t = avro.NewArraySchema(items)
+		}
+	case (el.GetConvertedType() == parquet.ConvertedType_MAP || el.GetConvertedType() == parquet.ConvertedType_MAP_KEY_VALUE) && el.GetNumChildren() == 1:
+		// the map group contains a repeated group containing the key and
+		// the value, parquetValue converts keys to strings
+		var values avro.Schema
+		if values, next, err = parquetAvroType(sh, i+3, namespace); err == nil {
+			t = avro.NewMapSchema(values)
+		}
+	default:
+		t, next, err = parquetAvroRecord(sh, i, name, namespace)
+	}
+	if err != nil || i == 0 {
+		return t, next, err
+	}
+
+	switch el.GetRepetitionType() { //nolint:exhaustive // required values keep their type
+	case parquet.FieldRepetitionType_OPTIONAL:
+		t, err = avro.NewUnionSchema([]avro.Schema{avro.NewNullSchema(), t})
+	case parquet.FieldRepetitionType_REPEATED:
+		t = avro.NewArraySchema(t)
+	}
+	return t, next, err
+}
+
+// parquetAvroRecord returns the Avro record of the group with index i and the
+// index of the element following its children.
+func parquetAvroRecord(sh *schema.SchemaHandler, i int, name, namespace string) (avro.Schema, int, error) {
+	childNamespace := name
+	if namespace != "" {
+		childNamespace = namespace + "." + name
+	}
+	fields := make([]*avro.Field, 0, sh.SchemaElements[i].GetNumChildren())
+	next := i + 1
+	for range sh.SchemaElements[i].GetNumChildren() {
+		child := next
+		t, n, err := parquetAvroType(sh, child, childNamespace)
+		if err != nil {
+			return nil, 0, err
+		}
+		f, err := avro.NewField(sh.Infos[child].ExName, t)
+		if err != nil {
+			return nil, 0, err
+		}
+		fields = append(fields, f)
+		next = n
+	}
+	s, err := avro.NewRecordSchema(name, namespace, fields)
+	return s, next, err
+}
+
+// parquetAvroPrimitive returns the Avro type of the values parquetPrimitive
+// returns for a column.
+func parquetAvroPrimitive(el *parquet.SchemaElement) avro.Schema {
+	switch el.GetType() {
+	case parquet.Type_BOOLEAN:
+		return avro.NewPrimitiveSchema(avro.Boolean, nil)
+	case parquet.Type_INT32:
+		if el.ConvertedType != nil && *el.ConvertedType == parquet.ConvertedType_DATE {
+			return avro.NewPrimitiveSchema(avro.Int, avro.NewPrimitiveLogicalSchema(avro.Date))
+		}
+		return avro.NewPrimitiveSchema(avro.Int, nil)
+	case parquet.Type_INT64:
+		return parquetAvroInt64(el)
+	case parquet.Type_INT96:
+		return avro.NewPrimitiveSchema(avro.Long, avro.NewPrimitiveLogicalSchema(avro.TimestampMicros))
+	case parquet.Type_FLOAT:
+		return avro.NewPrimitiveSchema(avro.Float, nil)
+	case parquet.Type_DOUBLE:
+		return avro.NewPrimitiveSchema(avro.Double, nil)
+	case parquet.Type_BYTE_ARRAY:
+		if el.ConvertedType != nil || el.LogicalType != nil {
+			return avro.NewPrimitiveSchema(avro.String, nil)
+		}
+		return avro.NewPrimitiveSchema(avro.Bytes, nil)
+	default:
+		return avro.NewPrimitiveSchema(avro.Bytes, nil)
+	}
+}
+
+// parquetAvroInt64 returns the Avro type of an INT64 column, timestamps are
+// returned as timestamps, nanosecond timestamps are truncated to microseconds.
+func parquetAvroInt64(el *parquet.SchemaElement) avro.Schema {
+	millis := avro.NewPrimitiveSchema(avro.Long, avro.NewPrimitiveLogicalSchema(avro.TimestampMillis))
+	micros := avro.NewPrimitiveSchema(avro.Long, avro.NewPrimitiveLogicalSchema(avro.TimestampMicros))
+	if lt := el.GetLogicalType(); lt != nil && lt.IsSetTIMESTAMP() {
+		if lt.GetTIMESTAMP().GetUnit().IsSetMILLIS() {
+			return millis
+		}
+		return micros
+	}
+	if el.ConvertedType != nil {
+		switch *el.ConvertedType { //nolint:exhaustive // other converted types keep the raw value
+		case parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return millis
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			return micros
+		}
+	}
+	return avro.NewPrimitiveSchema(avro.Long, nil)
+}
+
+func parquetSchemaElement(sh *schema.SchemaHandler, path string) *parquet.SchemaElement {
+	idx, ok := sh.MapIndex[path]
+	if !ok {
+		return nil
+	}
+	return sh.SchemaElements[idx]
+}
+
+func parquetColumnName(sh *schema.SchemaHandler, path string) string {
+	idx, ok := sh.MapIndex[path]
+	if !ok {
+		p := common.StrToPath(path)
+		return p[len(p)-1]
+	}
+	return sh.Infos[idx].ExName
+}
@@ -0,0 +1,91 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-sdk/schema"
+	"github.com/matryer/is"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type parquetTestRow struct {
+	Name      string            `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Age       *int32            `parquet:"name=age, type=INT32, repetitiontype=OPTIONAL"`
+	CreatedAt int64             `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Tags      []string          `parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Attrs     map[string]string `parquet:"name=attrs, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+func TestParquetRecordReader(t *testing.T) {
+	is := is.New(t)
+
+	age := int32(42)
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []parquetTestRow{
+		{Name: "foo", Age: &age, CreatedAt: createdAt.UnixMilli(), Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}},
+		{Name: "bar", CreatedAt: createdAt.UnixMilli(), Tags: []string{}, Attrs: map[string]string{}},
+	}
+
+	var buf bytes.Buffer
+	pw, err := writer.NewParquetWriterFromWriter(&buf, new(parquetTestRow), 1)
+	is.NoErr(err)
+	for _, row := range rows {
+		is.NoErr(pw.Write(row))
+	}
+	is.NoErr(pw.WriteStop())
+
+	r := newParquetRecordReader("file.parquet", io.NopCloser(&buf))
+	defer r.Close()
+
+	want := []opencdc.StructuredData{
+		{"name": "foo", "age": int32(42), "created_at": createdAt, "tags": []any{"a", "b"}, "attrs": map[string]any{"k": "v"}},
+		{"name": "bar", "age": nil, "created_at": createdAt, "tags": []any{}, "attrs": map[string]any{}},
+	}
+	for i, w := range want {
+		data, row, err := r.Next(context.Background())
+		is.NoErr(err)
+		is.Equal(row, int64(i+1))
+		is.Equal(data, w)
+
+		// the rows can be encoded with the registered schema
+		rec := restoreRecord(r, opencdc.Record{Metadata: opencdc.Metadata{}})
+		subject, err := rec.Metadata.GetPayloadSchemaSubject()
+		is.NoErr(err)
+		is.Equal(subject, "file.parquet")
+		version, err := rec.Metadata.GetPayloadSchemaVersion()
+		is.NoErr(err)
+		s, err := schema.Get(context.Background(), subject, version)
+		is.NoErr(err)
+		_, err = s.Marshal(data)
+		is.NoErr(err)
+	}
+	is.Equal(string(r.schema.Bytes), `{"name":"record","type":"record","fields":[`+
+		`{"name":"name","type":"string"},`+
+		`{"name":"age","type":["null","int"]},`+
+		`{"name":"created_at","type":{"type":"long","logicalType":"timestamp-millis"}},`+
+		`{"name":"tags","type":{"type":"array","items":"string"}},`+
+		`{"name":"attrs","type":{"type":"map","values":"string"}}]}`)
+
+	_, _, err = r.Next(context.Background())
+	is.True(errors.Is(err, io.EOF))
+}
@@ -0,0 +1,203 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// SnapshotConfig configures how the snapshot fetches objects.
+type SnapshotConfig struct {
+	// PrefetchConcurrency is the number of objects fetched in parallel ahead
+	// of the object that is read, 0 disables prefetching.
+	PrefetchConcurrency int
+	// PrefetchMemoryLimit is the number of bytes of prefetched objects kept
+	// in memory, larger objects are not prefetched. Objects that are
+	// streamed instead of read as a whole are never prefetched. The limit is shared with
+	// the changes fetched in parallel by the CDC iterators.
+	PrefetchMemoryLimit int64
+
+	// memory is the budget shared by all iterators of a source, a budget of
+	// PrefetchMemoryLimit bytes is used if it is nil
+	memory *memoryBudget
+}
+
+// memoryBudget limits the bytes of object bodies that are read into memory
+// before they are read as records. A nil budget doesn't allow any bytes.
+type memoryBudget struct {
+	limit int64
+
+	m    sync.Mutex
+	used int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{limit: limit}
+}
+
+// reserve reserves n bytes, it returns false if they don't fit in the budget.
+func (b *memoryBudget) reserve(n int64) bool {
+	if b == nil {
+		return n == 0
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// release releases n reserved bytes.
+func (b *memoryBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.used -= n
+}
+
+// fetchFunc fetches an object.
+type fetchFunc func(ctx context.Context, key string) (*s3.GetObjectOutput, error)
+
+// prefetchedObject is an object fetched in the background.
+type prefetchedObject struct {
+	key  string
+	size int64
+
+	// done is closed once the object is fetched
+	done   chan struct{}
+	object *s3.GetObjectOutput
+	err    error
+}
+
+// prefetcher fetches objects in the background, objects are queued in the
+// order they are read. The bodies of prefetched objects are kept in memory,
+// so only objects that are read as a whole are prefetched, other objects are
+// streamed once they are read.
+type prefetcher struct {
+	config SnapshotConfig
+	memory *memoryBudget
+	// enabled is false if objects are streamed instead of read as a whole
+	enabled bool
+	// maxSize is the size of the largest object that is prefetched, larger
+	// objects are handled by the large object policy, 0 means no limit
+	maxSize int64
+	fetch   fetchFunc
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	queue []*prefetchedObject
+	// bytes is the size of the queued objects
+	bytes int64
+}
+
+func newPrefetcher(config SnapshotConfig, readerConfig ReaderConfig, fetch fetchFunc) *prefetcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	memory := config.memory
+	if memory == nil {
+		memory = newMemoryBudget(config.PrefetchMemoryLimit)
+	}
+	return &prefetcher{
+		config:  config,
+		memory:  memory,
+		enabled: readerConfig.readsWholeObject(),
+		maxSize: readerConfig.MaxObjectSize,
+		fetch:   fetch,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// add starts fetching the object if the concurrency and memory limits allow
+// it, it returns false if the object is not prefetched.
+func (p *prefetcher) add(key string, size int64) bool {
+	if !p.enabled ||
+		len(p.queue) >= p.config.PrefetchConcurrency ||
+		(p.maxSize > 0 && size > p.maxSize) ||
+		!p.memory.reserve(size) {
+		return false
+	}
+
+	o := &prefetchedObject{key: key, size: size, done: make(chan struct{})}
+	p.queue = append(p.queue, o)
+	p.bytes += size
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(o.done)
+		o.object, o.err = p.fetchBody(key)
+	}()
+	return true
+}
+
+// fetchBody fetches the object and reads its body into memory.
+func (p *prefetcher) fetchBody(key string) (*s3.GetObjectOutput, error) {
+	object, err := p.fetch(p.ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %q: %w", key, err)
+	}
+	object.Body = io.NopCloser(bytes.NewReader(body))
+	return object, nil
+}
+
+// queued returns the number of objects that are queued.
+func (p *prefetcher) queued() int {
+	return len(p.queue)
+}
+
+// next returns the object if it is the next queued object, waiting until it
+// is fetched. ok is false if the object wasn't prefetched.
+func (p *prefetcher) next(ctx context.Context, key string) (object *s3.GetObjectOutput, ok bool, err error) {
+	if len(p.queue) == 0 || p.queue[0].key != key {
+		return nil, false, nil
+	}
+	o := p.queue[0]
+	select {
+	case <-o.done:
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	}
+	p.queue = p.queue[1:]
+	p.bytes -= o.size
+	p.memory.release(o.size)
+	return o.object, true, o.err
+}
+
+// stop cancels the objects that are being fetched and waits for the fetches
+// to return.
+func (p *prefetcher) stop() {
+	p.cancel()
+	p.wg.Wait()
+	p.queue = nil
+	p.memory.release(p.bytes)
+	p.bytes = 0
+}
@@ -0,0 +1,125 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/matryer/is"
+)
+
+func TestPrefetcher_Order(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	// fetches return in reverse order, objects are still returned in the
+	// order they were added
+	release := map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})}
+	fetch := func(ctx context.Context, key string) (*s3.GetObjectOutput, error) {
+		select {
+		case <-release[key]:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("body of " + key))}, nil
+	}
+	p := newPrefetcher(SnapshotConfig{PrefetchConcurrency: 2, PrefetchMemoryLimit: 100}, ReaderConfig{}, fetch)
+	defer p.stop()
+
+	is.True(p.add("a", 10))
+	is.True(p.add("b", 10))
+	is.True(!p.add("c", 10)) // concurrency limit reached
+	close(release["b"])
+	close(release["a"])
+
+	for _, key := range []string{"a", "b"} {
+		object, ok, err := p.next(ctx, key)
+		is.NoErr(err)
+		is.True(ok)
+		body, err := io.ReadAll(object.Body)
+		is.NoErr(err)
+		is.Equal(string(body), "body of "+key)
+	}
+	is.Equal(p.queued(), 0)
+}
+
+func TestPrefetcher_Limits(t *testing.T) {
+	is := is.New(t)
+	fetch := func(context.Context, string) (*s3.GetObjectOutput, error) {
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("")), ContentLength: aws.Int64(0)}, nil
+	}
+	p := newPrefetcher(SnapshotConfig{PrefetchConcurrency: 10, PrefetchMemoryLimit: 100}, ReaderConfig{MaxObjectSize: 50}, fetch)
+	defer p.stop()
+
+	is.True(!p.add("large", 60)) // larger than the maximum object size
+	is.True(p.add("a", 50))
+	is.True(p.add("b", 40))
+	is.True(!p.add("c", 20)) // memory limit reached
+
+	// objects that weren't prefetched are not returned
+	_, ok, err := p.next(context.Background(), "c")
+	is.NoErr(err)
+	is.True(!ok)
+}
+
+func TestPrefetcher_Disabled(t *testing.T) {
+	is := is.New(t)
+	p := newPrefetcher(SnapshotConfig{}, ReaderConfig{}, nil)
+	defer p.stop()
+	is.True(!p.add("a", 0))
+}
+
+func TestPrefetcher_Streamed(t *testing.T) {
+	is := is.New(t)
+	fetch := func(context.Context, string) (*s3.GetObjectOutput, error) {
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	memory := newMemoryBudget(100)
+	config := SnapshotConfig{PrefetchConcurrency: 10, memory: memory}
+
+	// objects split into lines are streamed, they are neither prefetched
+	// nor do they count against the budget
+	p := newPrefetcher(config, ReaderConfig{SplitMode: SplitModeNewline}, fetch)
+	defer p.stop()
+	is.True(!p.add("a", 60))
+	is.True(memory.reserve(100))
+}
+
+func TestPrefetcher_SharedMemory(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	fetch := func(context.Context, string) (*s3.GetObjectOutput, error) {
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	memory := newMemoryBudget(100)
+	p := newPrefetcher(SnapshotConfig{PrefetchConcurrency: 10, memory: memory}, ReaderConfig{}, fetch)
+	defer p.stop()
+
+	// prefetched objects count against the budget of the CDC fetches
+	is.True(p.add("a", 60))
+	is.True(!memory.reserve(50))
+	is.True(memory.reserve(40))
+	is.True(!p.add("b", 10))
+
+	_, ok, err := p.next(ctx, "a")
+	is.NoErr(err)
+	is.True(ok)
+	is.True(memory.reserve(50))
+}
@@ -16,6 +16,7 @@ package iterator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -35,22 +36,91 @@ type SnapshotIterator struct {
 	page            *s3.ListObjectsV2Output
 	index           int
 	maxLastModified time.Time
+	snapshotStart   time.Time
+	readerConfig    ReaderConfig
+	// prefetcher fetches the next objects of the page in the background
+	prefetcher *prefetcher
+
+	// object that was partially read before the snapshot was interrupted
+	resumeKey  string
+	resumeLine int64
+
+	// the object that is currently being read
+	key       string
+	object    *s3.GetObjectOutput
+	reader    recordReader
+	skipLines int64
+	// group tracks the records read from the current object, it is nil if
+	// nothing happens once they are acknowledged
+	group *ackGroup
+
+	// next record to return, fetched in advance so HasNext knows if the
+	// snapshot is done
+	next    *opencdc.Record
+	nextAck ackFunc
+	err     error
 }
 
 // NewSnapshotIterator takes the s3 bucket, the client, and the position.
-// it returns a snapshotIterator starting from the position provided.
-func NewSnapshotIterator(bucket, prefix string, client *s3.Client, p position.Position) (*SnapshotIterator, error) {
+// it returns a snapshotIterator starting from the position provided. If the
+// position contains a key, the snapshot resumes after that key, or after the
+// line in that key if objects are split into lines.
+func NewSnapshotIterator(
+	bucket, prefix string,
+	snapshotConfig SnapshotConfig,
+	readerConfig ReaderConfig,
+	client *s3.Client,
+	p position.Position,
+) (*SnapshotIterator, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
 		Prefix: aws.String(prefix),
 	}
 
-	return &SnapshotIterator{
+	snapshotStart := p.SnapshotStart
+	if p.Key != "" {
+		// objects are listed in lexicographical order, so we can continue
+		// right after the last key that was read
+		input.StartAfter = aws.String(p.Key)
+	} else {
+		snapshotStart = time.Now()
+	}
+
+	w := &SnapshotIterator{
 		bucket:          bucket,
 		client:          client,
 		paginator:       s3.NewListObjectsV2Paginator(client, input),
 		maxLastModified: p.Timestamp,
-	}, nil
+		snapshotStart:   snapshotStart,
+		readerConfig:    readerConfig,
+	}
+	w.prefetcher = newPrefetcher(snapshotConfig, readerConfig, w.getObject)
+	if p.Line > 0 {
+		// the object was only partially read, read the rest before
+		// continuing with the listing
+		w.resumeKey = p.Key
+		w.resumeLine = p.Line
+	}
+	return w, nil
+}
+
+// cdcStart returns the timestamp after which the CDC iterator needs to detect
+// changes so that no change made during the snapshot is missed.
+func (w *SnapshotIterator) cdcStart() time.Time {
+	switch {
+	case !w.snapshotStart.IsZero():
+		// any object modified after the snapshot started could have been
+		// skipped by the listing, positions and S3 timestamps have second
+		// precision, so we go back one second to be on the safe side
+		return w.snapshotStart.Truncate(time.Second).Add(-time.Second)
+	case !w.maxLastModified.IsZero():
+		// position from a snapshot that doesn't track its start time
+		return w.maxLastModified
+	default:
+		// zero timestamp means nil position (empty bucket), so start
+		// detecting actions from now
+		return time.Now()
+	}
 }
 
 // shouldRefreshPage returns a boolean indicating whether the SnapshotIterator is empty or not.
@@ -68,6 +138,19 @@ func (w *SnapshotIterator) refreshPage(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("could not fetch next page: %w", err)
 		}
+		// skip filtered objects so they are never downloaded
+		contents := nextPage.Contents[:0]
+		for _, object := range nextPage.Contents {
+			ok, err := w.readerConfig.Filter.match(ctx, w.client, w.bucket, *object.Key, aws.ToInt64(object.Size), nil)
+			if err != nil {
+				return err
+			}
+			if ok {
+				contents = append(contents, object)
+			}
+		}
+		nextPage.Contents = contents
+
 		if len(nextPage.Contents) > 0 {
 			w.page = nextPage
 			break
@@ -79,38 +162,125 @@ func (w *SnapshotIterator) refreshPage(ctx context.Context) error {
 	return nil
 }
 
-// HasNext returns a boolean that indicates whether the iterator has more objects to return or not.
+// HasNext returns a boolean that indicates whether the iterator has more records to return or not.
 func (w *SnapshotIterator) HasNext(ctx context.Context) bool {
-	if w.shouldRefreshPage() {
-		err := w.refreshPage(ctx)
-		if err != nil {
-			return false
-		}
+	if w.next != nil || w.err != nil {
+		return true
+	}
+	err := w.fetchNext(ctx)
+	if errors.Is(err, sdk.ErrBackoffRetry) {
+		return false // end of bucket
+	}
+	if err != nil {
+		// return true so the caller fetches the error with Next
+		w.err = err
 	}
 	return true
 }
 
-// Next returns the next record in the iterator.
+// Next returns the next record in the iterator and the function
+// acknowledging it, the function is nil if the record doesn't need to be
+// acknowledged.
 // returns an empty record and an error if anything wrong happened.
-func (w *SnapshotIterator) Next(ctx context.Context) (opencdc.Record, error) {
-	if w.shouldRefreshPage() {
-		err := w.refreshPage(ctx)
+func (w *SnapshotIterator) Next(ctx context.Context) (opencdc.Record, ackFunc, error) {
+	if w.next == nil && w.err == nil {
+		w.err = w.fetchNext(ctx)
+	}
+	if w.err != nil {
+		err := w.err
+		w.err = nil
+		return opencdc.Record{}, nil, err
+	}
+
+	r, ack := *w.next, w.nextAck
+	w.next, w.nextAck = nil, nil
+	return r, ack, nil
+}
+
+// fetchNext reads the next record and stores it in w.next, it opens the next
+// object when the current one has no more records.
+func (w *SnapshotIterator) fetchNext(ctx context.Context) error {
+	for {
+		if w.reader == nil {
+			err := w.openNextObject(ctx)
+			if errors.Is(err, errObjectSkipped) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		payload, line, err := w.reader.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			err := w.group.sent(ctx)
+			w.closeObject()
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		if err != nil {
-			return opencdc.Record{}, err
+			return fmt.Errorf("could not read %q: %w", w.key, err)
 		}
+		if line > 0 && line <= w.skipLines {
+			continue // already read before the snapshot was interrupted
+		}
+
+		p := position.Position{
+			Key:           w.key,
+			Type:          position.TypeSnapshot,
+			Timestamp:     w.maxLastModified,
+			SnapshotStart: w.snapshotStart,
+			Line:          line,
+		}
+
+		// create the record
+		r := sdk.Util.Source.NewRecordSnapshot(
+			p.ToRecordPosition(), objectMetadata(w.object, line),
+			opencdc.RawData(w.key),
+			payload,
+		)
+		r = restoreRecord(w.reader, r)
+		w.next = &r
+		w.nextAck = w.group.track()
+		return nil
 	}
+}
 
-	// after making sure the object is available, get the object's key
-	key := w.page.Contents[w.index].Key
-	w.index++
+// openNextObject fetches the next object, either the one that needs to be
+// resumed or the next one in the listing.
+func (w *SnapshotIterator) openNextObject(ctx context.Context) error {
+	var key string
+	var skipLines int64
+	if w.resumeKey != "" {
+		key, skipLines = w.resumeKey, w.resumeLine
+		w.resumeKey, w.resumeLine = "", 0
+	} else {
+		if w.shouldRefreshPage() {
+			err := w.refreshPage(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		// after making sure the object is available, get the object's key
+		key = *w.page.Contents[w.index].Key
+		w.index++
+	}
 
-	// read object
-	object, err := w.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(w.bucket),
-		Key:    key,
-	})
+	// read object, it was fetched in the background if it was prefetched
+	object, ok, err := w.prefetcher.next(ctx, key)
+	if !ok {
+		object, err = w.getObject(ctx, key)
+	}
+	if err != nil {
+		return fmt.Errorf("could not fetch the next object: %w", err)
+	}
+	w.prefetch()
+
+	reader, err := w.readerConfig.open(ctx, w.client, w.bucket, key, object, skipLines)
 	if err != nil {
-		return opencdc.Record{}, fmt.Errorf("could not fetch the next object: %w", err)
+		return err
 	}
 
 	// check if maxLastModified should be updated
@@ -118,32 +288,48 @@ func (w *SnapshotIterator) Next(ctx context.Context) (opencdc.Record, error) {
 		w.maxLastModified = *object.LastModified
 	}
 
-	rawBody, err := io.ReadAll(object.Body)
-	if err != nil {
-		return opencdc.Record{}, fmt.Errorf("could not read the object's body: %w", err)
-	}
+	w.key = key
+	w.object = object
+	w.reader = reader
+	w.skipLines = skipLines
+	w.group = w.readerConfig.objectAckGroup(w.bucket, key, object)
+	return nil
+}
 
-	p := position.Position{
-		Key:       *key,
-		Type:      position.TypeSnapshot,
-		Timestamp: w.maxLastModified,
-	}
+func (w *SnapshotIterator) getObject(ctx context.Context, key string) (*s3.GetObjectOutput, error) {
+	return w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(key),
+	})
+}
 
-	m := opencdc.Metadata{
-		MetadataS3HeaderPrefix + MetadataContentType: *object.ContentType,
+// prefetch starts fetching the objects following the current object in the
+// page, objects are prefetched in order until the concurrency or memory limit
+// is reached.
+func (w *SnapshotIterator) prefetch() {
+	if w.page == nil {
+		return
 	}
-	for key, val := range object.Metadata {
-		m[key] = val
+	for i := w.index + w.prefetcher.queued(); i < len(w.page.Contents); i++ {
+		object := w.page.Contents[i]
+		if !w.prefetcher.add(*object.Key, aws.ToInt64(object.Size)) {
+			return
+		}
 	}
+}
 
-	// create the record
-	return sdk.Util.Source.NewRecordSnapshot(
-		p.ToRecordPosition(), m,
-		opencdc.RawData(*key),
-		opencdc.RawData(rawBody),
-	), nil
+func (w *SnapshotIterator) closeObject() {
+	if w.reader != nil {
+		_ = w.reader.Close()
+	}
+	w.key = ""
+	w.object = nil
+	w.reader = nil
+	w.skipLines = 0
+	w.group = nil
 }
 
 func (w *SnapshotIterator) Stop() {
-	// nothing to stop
+	w.prefetcher.stop()
+	w.closeObject()
 }
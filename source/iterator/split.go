@@ -0,0 +1,185 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
+)
+
+// SplitMode defines how an object body is split into records.
+type SplitMode string
+
+const (
+	// SplitModeObject produces one record per object.
+	SplitModeObject SplitMode = "object"
+	// SplitModeNewline produces one record per line, empty lines are skipped.
+	SplitModeNewline SplitMode = "newline"
+	// SplitModeCSV parses objects as CSV and produces one record per row
+	// with a structured payload.
+	SplitModeCSV SplitMode = "csv"
+	// SplitModeParquet reads Parquet objects and produces one record per row
+	// with a structured payload.
+	SplitModeParquet SplitMode = "parquet"
+)
+
+// ReaderConfig configures which objects are read, how object bodies are
+// turned into records and what happens once the records are acknowledged.
+type ReaderConfig struct {
+	// Filter decides which objects are read.
+	Filter    ObjectFilter
+	SplitMode SplitMode
+	// Compression defines how object bodies are decompressed before they
+	// are split, CompressionAuto is used if empty.
+	Compression Compression
+	// CSV is only used if SplitMode is SplitModeCSV.
+	CSV CSVOptions
+	// Format is set to decode files written by the S3 destination back into
+	// the original records, SplitMode is ignored in that case.
+	Format format.Format
+	// MaxObjectSize is the size in bytes of the largest object that is read
+	// as configured by SplitMode or Format, larger objects are handled as
+	// defined by LargeObjects. 0 means there is no limit.
+	MaxObjectSize int64
+	LargeObjects  LargeObjectPolicy
+	// ChunkSize is the size in bytes of the chunks large objects are split
+	// into, MaxObjectSize is used if it is 0.
+	ChunkSize int64
+	// ObjectAcked is called once all records read from an object are
+	// acknowledged, it is not called for deleted objects. Nothing happens on
+	// acknowledgment if it is nil.
+	ObjectAcked ObjectAckedFunc
+}
+
+// readsWholeObject returns true if object bodies are read into memory as a
+// whole to be turned into records, instead of being streamed.
+func (c ReaderConfig) readsWholeObject() bool {
+	if c.Format != "" {
+		return c.Format == format.Parquet
+	}
+	return c.SplitMode == SplitModeObject || c.SplitMode == "" || c.SplitMode == SplitModeParquet
+}
+
+// MetadataLine is the metadata key containing the 1-based line (or row)
+// number of a record when objects are split into multiple records.
+const MetadataLine = "s3.line"
+
+// recordReader returns the payloads of the records contained in an object
+// body.
+type recordReader interface {
+	// Next returns the next payload and its 1-based line (or row) in the
+	// object, line 0 means the payload is the whole object. Returns io.EOF
+	// when there are no more payloads.
+	Next(ctx context.Context) (opencdc.Data, int64, error)
+	Close() error
+}
+
+// openObject returns a reader returning the payloads contained in the
+// object's body after it is decompressed. The object's body is closed if the
+// reader can't be created.
+func openObject(cfg ReaderConfig, key string, object *s3.GetObjectOutput) (recordReader, error) {
+	body, err := decompress(cfg.Compression, key, object)
+	if err != nil {
+		_ = object.Body.Close()
+		return nil, fmt.Errorf("could not decompress %q: %w", key, err)
+	}
+	reader, err := newRecordReader(cfg, key, body)
+	if err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+func newRecordReader(cfg ReaderConfig, key string, body io.ReadCloser) (recordReader, error) {
+	if cfg.Format != "" {
+		return newArchiveRecordReader(cfg.Format, body), nil
+	}
+	switch cfg.SplitMode {
+	case SplitModeObject, "":
+		return &objectRecordReader{body: body}, nil
+	case SplitModeNewline:
+		return &newlineRecordReader{body: body, reader: bufio.NewReader(body)}, nil
+	case SplitModeCSV:
+		return newCSVRecordReader(cfg.CSV, body), nil
+	case SplitModeParquet:
+		return newParquetRecordReader(key, body), nil
+	default:
+		return nil, fmt.Errorf("unsupported split mode %q", cfg.SplitMode)
+	}
+}
+
+// objectRecordReader returns the whole object as a single payload.
+type objectRecordReader struct {
+	body io.ReadCloser
+	done bool
+}
+
+func (r *objectRecordReader) Next(context.Context) (opencdc.Data, int64, error) {
+	if r.done {
+		return nil, 0, io.EOF
+	}
+	r.done = true
+	rawBody, err := io.ReadAll(r.body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not read the object's body: %w", err)
+	}
+	return opencdc.RawData(rawBody), 0, nil
+}
+
+func (r *objectRecordReader) Close() error {
+	return r.body.Close()
+}
+
+// newlineRecordReader returns each non-empty line as a payload, line
+// endings are stripped.
+type newlineRecordReader struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	line   int64
+}
+
+func (r *newlineRecordReader) Next(context.Context) (opencdc.Data, int64, error) {
+	for {
+		b, err := r.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, 0, fmt.Errorf("could not read the object's body: %w", err)
+		}
+		if len(b) == 0 && errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		r.line++
+
+		b = bytes.TrimRight(b, "\r\n")
+		if len(b) == 0 {
+			// skip empty lines, they still count towards the line number
+			// so positions stay stable
+			continue
+		}
+		return opencdc.RawData(b), r.line, nil
+	}
+}
+
+func (r *newlineRecordReader) Close() error {
+	return r.body.Close()
+}
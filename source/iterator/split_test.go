@@ -0,0 +1,100 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/destination/format"
+	"github.com/matryer/is"
+)
+
+func TestRecordReader_Newline(t *testing.T) {
+	is := is.New(t)
+	body := io.NopCloser(strings.NewReader("{\"a\":1}\r\n\n{\"a\":2}\n{\"a\":3}"))
+
+	r, err := newRecordReader(ReaderConfig{SplitMode: SplitModeNewline}, "file", body)
+	is.NoErr(err)
+
+	type line struct {
+		payload string
+		line    int64
+	}
+	var got []line
+	for {
+		payload, n, err := r.Next(context.Background())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		is.NoErr(err)
+		got = append(got, line{payload: string(payload.Bytes()), line: n})
+	}
+
+	is.Equal(got, []line{
+		{payload: `{"a":1}`, line: 1},
+		{payload: `{"a":2}`, line: 3},
+		{payload: `{"a":3}`, line: 4},
+	})
+}
+
+func TestRecordReader_Object(t *testing.T) {
+	is := is.New(t)
+	body := io.NopCloser(strings.NewReader("line 1\nline 2\n"))
+
+	r, err := newRecordReader(ReaderConfig{SplitMode: SplitModeObject}, "file", body)
+	is.NoErr(err)
+
+	payload, n, err := r.Next(context.Background())
+	is.NoErr(err)
+	is.Equal(payload, opencdc.RawData("line 1\nline 2\n"))
+	is.Equal(n, int64(0))
+
+	_, _, err = r.Next(context.Background())
+	is.True(errors.Is(err, io.EOF))
+}
+
+func TestRecordReader_Archive(t *testing.T) {
+	is := is.New(t)
+	want := opencdc.Record{
+		Operation: opencdc.OperationUpdate,
+		Position:  opencdc.Position("original"),
+		Key:       opencdc.RawData("key-1"),
+		Metadata:  opencdc.Metadata{"foo": "bar"},
+		Payload:   opencdc.Change{After: opencdc.RawData("payload")},
+	}
+	data, err := format.JSON.MakeBytes(context.Background(), []opencdc.Record{want}, format.Options{})
+	is.NoErr(err)
+
+	r, err := newRecordReader(ReaderConfig{SplitMode: SplitModeObject, Format: format.JSON}, "file", io.NopCloser(bytes.NewReader(data)))
+	is.NoErr(err)
+
+	payload, n, err := r.Next(context.Background())
+	is.NoErr(err)
+	is.Equal(payload, opencdc.RawData("payload"))
+	is.Equal(n, int64(1))
+
+	got := restoreRecord(r, opencdc.Record{Position: opencdc.Position("file.json_s1:1")})
+	want.Position = opencdc.Position("file.json_s1:1")
+	is.Equal(got, want)
+
+	_, _, err = r.Next(context.Background())
+	is.True(errors.Is(err, io.EOF))
+}
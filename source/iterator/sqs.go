@@ -0,0 +1,450 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-s3/source/position"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"gopkg.in/tomb.v2"
+)
+
+// SQSClient contains the SQS operations used to consume S3 event
+// notifications.
+type SQSClient interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// SQSConfig configures how S3 event notifications are received from SQS.
+type SQSConfig struct {
+	QueueURL string
+	// WaitTime is the long polling duration of a receive call.
+	WaitTime time.Duration
+	// MaxMessages is the maximum number of messages received at once.
+	MaxMessages int32
+	// VisibilityTimeout is how long received messages are hidden from other
+	// consumers, it is extended until all records of a message are
+	// acknowledged. The queue's visibility timeout is used if it is 0.
+	VisibilityTimeout time.Duration
+}
+
+// SQSConsumer detects changes by consuming S3 event notifications from an SQS
+// queue instead of listing the bucket. The changes of each location are
+// returned by the location's SQSIterator. A message is deleted from the queue
+// once all records created from it are acknowledged, until then its visibility
+// timeout is extended. Messages of which an event can't be processed are
+// neither deleted nor extended, so they are delivered again after the
+// visibility timeout, or moved to the dead letter queue if the queue has one.
+type SQSConsumer struct {
+	client       SQSClient
+	s3Client     *s3.Client
+	config       SQSConfig
+	readerConfig ReaderConfig
+	locations    []Location
+	tomb         *tomb.Tomb
+
+	m         sync.Mutex
+	iterators map[string]*SQSIterator // by location collection
+	// receipt handles of the messages of which not all records are
+	// acknowledged yet
+	inFlight map[string]bool
+}
+
+// NewSQSConsumer returns a consumer for the locations, it starts consuming the
+// queue once all locations are subscribed, i.e. once all locations finished
+// their snapshot. Events sent during a snapshot stay in the queue until then.
+func NewSQSConsumer(
+	client SQSClient,
+	s3Client *s3.Client,
+	config SQSConfig,
+	readerConfig ReaderConfig,
+	locations []Location,
+) *SQSConsumer {
+	return &SQSConsumer{
+		client:       client,
+		s3Client:     s3Client,
+		config:       config,
+		readerConfig: readerConfig,
+		locations:    locations,
+		tomb:         &tomb.Tomb{},
+		iterators:    make(map[string]*SQSIterator, len(locations)),
+		inFlight:     make(map[string]bool),
+	}
+}
+
+// Subscribe returns the iterator returning the changes of the location.
+func (c *SQSConsumer) Subscribe(l Location) *SQSIterator {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if it, ok := c.iterators[l.Collection()]; ok {
+		return it
+	}
+	it := &SQSIterator{
+		consumer: c,
+		buffer:   make(chan bufferedRecord, 1),
+	}
+	c.iterators[l.Collection()] = it
+	if len(c.iterators) == len(c.locations) {
+		c.tomb.Go(c.consume)
+		if c.config.VisibilityTimeout > 0 {
+			c.tomb.Go(c.extendVisibility)
+		}
+	}
+	return it
+}
+
+// Stop stops consuming the queue.
+func (c *SQSConsumer) Stop() {
+	c.tomb.Kill(errors.New("sqs consumer is stopped"))
+}
+
+// consume receives messages until the consumer is stopped.
+func (c *SQSConsumer) consume() error {
+	ctx := c.tomb.Context(nil) //nolint:staticcheck // SA1012 tomb expects nil
+	for {
+		select {
+		case <-c.tomb.Dying():
+			return c.tomb.Err()
+		default:
+		}
+
+		out, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(c.config.QueueURL),
+			MaxNumberOfMessages: c.config.MaxMessages,
+			WaitTimeSeconds:     int32(c.config.WaitTime / time.Second),          //nolint:gosec // validated to be at most 20s
+			VisibilityTimeout:   int32(c.config.VisibilityTimeout / time.Second), //nolint:gosec // validated to be at most 12h
+		})
+		if err != nil {
+			if !c.tomb.Alive() {
+				return c.tomb.Err()
+			}
+			return fmt.Errorf("could not receive messages from SQS: %w", err)
+		}
+		for _, msg := range out.Messages {
+			err := c.handleMessage(ctx, aws.ToString(msg.Body), msg.ReceiptHandle)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleMessage sends the records of the events contained in the message to
+// the iterators of their locations. It only returns an error if the consumer
+// is stopped, messages that can't be processed are skipped.
+func (c *SQSConsumer) handleMessage(ctx context.Context, body string, receiptHandle *string) error {
+	event, err := parseS3Event(body)
+	if err != nil {
+		// the message becomes visible again, so it ends up in the dead
+		// letter queue if the queue has one
+		sdk.Logger(ctx).Warn().Err(err).Msg("skipping SQS message that doesn't contain an S3 event")
+		return nil
+	}
+
+	c.setInFlight(receiptHandle, true)
+	msg := &ackGroup{
+		acked: func(ctx context.Context) error {
+			c.setInFlight(receiptHandle, false)
+			_, err := c.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(c.config.QueueURL),
+				ReceiptHandle: receiptHandle,
+			})
+			if err != nil {
+				return fmt.Errorf("could not delete SQS message: %w", err)
+			}
+			return nil
+		},
+	}
+	for _, rec := range event.Records {
+		err := c.handleEvent(ctx, rec, msg)
+		if err != nil {
+			if !c.tomb.Alive() {
+				return err
+			}
+			// the message is never deleted, it becomes visible again and
+			// ends up in the dead letter queue if the queue has one, the
+			// records that were already sent are read again
+			c.setInFlight(receiptHandle, false)
+			sdk.Logger(ctx).Warn().Err(err).Msg("skipping SQS message with an S3 event that could not be processed")
+			return nil
+		}
+	}
+	// a message without records is deleted right away, if that fails the
+	// message becomes visible again and is read again
+	if err := msg.sent(ctx); err != nil {
+		sdk.Logger(ctx).Warn().Err(err).Msg("could not delete SQS message without records")
+	}
+	return nil
+}
+
+// setInFlight marks the message as in flight, i.e. its visibility timeout is
+// extended, or removes the mark.
+func (c *SQSConsumer) setInFlight(receiptHandle *string, inFlight bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if inFlight {
+		c.inFlight[aws.ToString(receiptHandle)] = true
+	} else {
+		delete(c.inFlight, aws.ToString(receiptHandle))
+	}
+}
+
+// extendVisibility extends the visibility timeout of the messages in flight
+// every half visibility timeout until the consumer is stopped.
+func (c *SQSConsumer) extendVisibility() error {
+	ctx := c.tomb.Context(nil) //nolint:staticcheck // SA1012 tomb expects nil
+	ticker := time.NewTicker(c.config.VisibilityTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.tomb.Dying():
+			return c.tomb.Err()
+		case <-ticker.C:
+			c.extend(ctx)
+		}
+	}
+}
+
+// extend extends the visibility timeout of the messages in flight, failures
+// are logged as the message might have been deleted in the meantime.
+func (c *SQSConsumer) extend(ctx context.Context) {
+	c.m.Lock()
+	handles := make([]string, 0, len(c.inFlight))
+	for h := range c.inFlight {
+		handles = append(handles, h)
+	}
+	c.m.Unlock()
+
+	for _, h := range handles {
+		_, err := c.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(c.config.QueueURL),
+			ReceiptHandle:     aws.String(h),
+			VisibilityTimeout: int32(c.config.VisibilityTimeout / time.Second), //nolint:gosec // validated to be at most 12h
+		})
+		if err != nil && c.tomb.Alive() {
+			sdk.Logger(ctx).Warn().Err(err).Msg("could not extend the visibility timeout of SQS message")
+		}
+	}
+}
+
+// handleEvent builds the records for a single event, events of objects
+// outside of the locations or filtered objects don't produce records.
+func (c *SQSConsumer) handleEvent(ctx context.Context, e s3EventRecord, msg *ackGroup) error {
+	key, err := url.QueryUnescape(e.S3.Object.Key)
+	if err != nil {
+		return fmt.Errorf("invalid key in S3 event %q: %w", e.S3.Object.Key, err)
+	}
+	it, ok := c.iterator(e.S3.Bucket.Name, key)
+	if !ok {
+		return nil
+	}
+
+	p := position.Position{
+		Key:       key,
+		Timestamp: e.EventTime,
+		Type:      position.TypeCDC,
+	}
+	switch {
+	case strings.HasPrefix(e.EventName, "ObjectRemoved:"):
+		// the records in a deleted file were already read when the file was
+		// created
+		if c.readerConfig.Format != "" || !c.readerConfig.Filter.MatchKey(key) {
+			return nil
+		}
+		r := sdk.Util.Source.NewRecordDelete(
+			p.ToRecordPosition(), opencdc.Metadata{},
+			opencdc.RawData(key),
+			nil,
+		)
+		return it.send(r, msg.track())
+	case strings.HasPrefix(e.EventName, "ObjectCreated:"):
+		var versionID *string
+		if e.S3.Object.VersionID != "" {
+			versionID = aws.String(e.S3.Object.VersionID)
+		}
+		ok, err := c.readerConfig.Filter.match(ctx, c.s3Client, e.S3.Bucket.Name, key, e.S3.Object.Size, versionID)
+		if err != nil || !ok {
+			return err
+		}
+		return c.sendObject(ctx, it, e.S3.Bucket.Name, versionID, p, msg)
+	default:
+		return nil
+	}
+}
+
+// sendObject fetches the created object and sends its records.
+func (c *SQSConsumer) sendObject(ctx context.Context, it *SQSIterator, bucket string, versionID *string, p position.Position, msg *ackGroup) error {
+	object, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(p.Key),
+		VersionId: versionID,
+	})
+	var notFound *types.NoSuchKey
+	if errors.As(err, &notFound) {
+		// the object was deleted in the meantime, the delete has its own
+		// event
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not fetch S3 object %q: %w", p.Key, err)
+	}
+	reader, err := c.readerConfig.open(ctx, c.s3Client, bucket, p.Key, object, 0)
+	if errors.Is(err, errObjectSkipped) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	objectGroup := c.readerConfig.objectAckGroup(bucket, p.Key, object)
+
+	for {
+		payload, line, err := reader.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return objectGroup.sent(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %q: %w", p.Key, err)
+		}
+
+		p.Line = line
+		r := sdk.Util.Source.NewRecordCreate(
+			p.ToRecordPosition(), objectMetadata(object, line),
+			opencdc.RawData(p.Key),
+			payload,
+		)
+		r = restoreRecord(reader, r)
+		err = it.send(r, combineAcks(msg.track(), objectGroup.track()))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// iterator returns the iterator of the first location containing the key.
+func (c *SQSConsumer) iterator(bucket, key string) (*SQSIterator, bool) {
+	for _, l := range c.locations {
+		if l.Bucket == bucket && strings.HasPrefix(key, l.Prefix) {
+			c.m.Lock()
+			it, ok := c.iterators[l.Collection()]
+			c.m.Unlock()
+			return it, ok
+		}
+	}
+	return nil, false
+}
+
+// SQSIterator returns the changes of a single location detected by an
+// SQSConsumer.
+type SQSIterator struct {
+	consumer *SQSConsumer
+	buffer   chan bufferedRecord
+}
+
+// HasNext returns true if there is a record in the buffer.
+func (w *SQSIterator) HasNext(_ context.Context) bool {
+	return len(w.buffer) > 0 || !w.consumer.tomb.Alive() // if tomb is dead we return true so caller will fetch error with Next
+}
+
+// Next returns the next record and the function acknowledging it.
+func (w *SQSIterator) Next(ctx context.Context) (opencdc.Record, ackFunc, error) {
+	select {
+	case r := <-w.buffer:
+		return r.record, r.ack, nil
+	case <-w.consumer.tomb.Dead():
+		return opencdc.Record{}, nil, w.consumer.tomb.Err()
+	case <-ctx.Done():
+		return opencdc.Record{}, nil, ctx.Err()
+	}
+}
+
+// Stop stops the consumer, which is shared by all locations.
+func (w *SQSIterator) Stop() {
+	w.consumer.Stop()
+}
+
+// send puts the record in the buffer, it returns an error if the consumer is
+// stopped.
+func (w *SQSIterator) send(r opencdc.Record, ack ackFunc) error {
+	select {
+	case w.buffer <- bufferedRecord{record: r, ack: ack}:
+		return nil
+	case <-w.consumer.tomb.Dying():
+		return w.consumer.tomb.Err()
+	}
+}
+
+// s3Event is an S3 event notification, test events only contain the event
+// name.
+type s3Event struct {
+	Event   string          `json:"Event"`
+	Records []s3EventRecord `json:"Records"`
+}
+
+type s3EventRecord struct {
+	EventName string    `json:"eventName"`
+	EventTime time.Time `json:"eventTime"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key       string `json:"key"`
+			Size      int64  `json:"size"`
+			VersionID string `json:"versionId"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// snsNotification is the envelope of S3 events sent to SQS through SNS.
+type snsNotification struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// parseS3Event parses the body of an SQS message containing an S3 event
+// notification, sent directly or through SNS.
+func parseS3Event(body string) (s3Event, error) {
+	var sns snsNotification
+	if err := json.Unmarshal([]byte(body), &sns); err == nil && sns.Type == "Notification" {
+		body = sns.Message
+	}
+
+	var event s3Event
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return s3Event{}, fmt.Errorf("could not parse S3 event: %w", err)
+	}
+	if event.Records == nil && event.Event == "" {
+		return s3Event{}, errors.New("message is not an S3 event")
+	}
+	return event, nil
+}
@@ -0,0 +1,205 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+// fakeSQS is an SQSClient without messages that records deleted messages
+// and messages of which the visibility timeout was changed.
+type fakeSQS struct {
+	m       sync.Mutex
+	deleted []string
+	changed []string
+
+	// deleteErr is returned by DeleteMessage if set.
+	deleteErr error
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (f *fakeSQS) DeleteMessage(_ context.Context, in *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.deleteErr != nil {
+		return nil, f.deleteErr
+	}
+	f.deleted = append(f.deleted, aws.ToString(in.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(_ context.Context, in *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.changed = append(f.changed, aws.ToString(in.ReceiptHandle))
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) changedMessages() []string {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return append([]string(nil), f.changed...)
+}
+
+func (f *fakeSQS) deletedMessages() []string {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return append([]string(nil), f.deleted...)
+}
+
+const testS3Event = `{"Records":[
+	{"eventName":"ObjectRemoved:Delete","eventTime":"2024-01-02T03:04:05.000Z","s3":{"bucket":{"name":"bucket"},"object":{"key":"logs/a+b.json"}}},
+	{"eventName":"ObjectRemoved:Delete","eventTime":"2024-01-02T03:04:05.000Z","s3":{"bucket":{"name":"bucket"},"object":{"key":"other/c.json"}}}
+]}`
+
+func TestParseS3Event(t *testing.T) {
+	is := is.New(t)
+
+	event, err := parseS3Event(testS3Event)
+	is.NoErr(err)
+	is.Equal(len(event.Records), 2)
+	is.Equal(event.Records[0].EventName, "ObjectRemoved:Delete")
+	is.Equal(event.Records[0].S3.Bucket.Name, "bucket")
+	is.Equal(event.Records[0].S3.Object.Key, "logs/a+b.json")
+
+	// events sent through SNS are wrapped in a notification
+	sns, err := json.Marshal(snsNotification{Type: "Notification", Message: testS3Event})
+	is.NoErr(err)
+	event, err = parseS3Event(string(sns))
+	is.NoErr(err)
+	is.Equal(len(event.Records), 2)
+
+	event, err = parseS3Event(`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"bucket"}`)
+	is.NoErr(err)
+	is.Equal(len(event.Records), 0)
+
+	_, err = parseS3Event(`{"foo":"bar"}`)
+	is.True(err != nil)
+}
+
+func TestSQSConsumer_DeleteAfterAck(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := &fakeSQS{}
+	location := Location{Bucket: "bucket", Prefix: "logs/"}
+	consumer := NewSQSConsumer(client, nil, SQSConfig{QueueURL: "queue"}, ReaderConfig{}, []Location{location})
+	defer consumer.Stop()
+	it := consumer.Subscribe(location)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- consumer.handleMessage(ctx, testS3Event, aws.String("message-1"))
+	}()
+
+	r, ack, err := it.Next(ctx)
+	is.NoErr(err)
+	is.Equal(r.Operation, opencdc.OperationDelete)
+	is.Equal(r.Key, opencdc.RawData("logs/a b.json"))
+	is.NoErr(<-errs)
+
+	// the event outside of the location doesn't produce a record, the
+	// message is deleted once the only record is acked
+	is.Equal(client.deletedMessages(), []string(nil))
+	is.NoErr(ack(ctx))
+	is.Equal(client.deletedMessages(), []string{"message-1"})
+}
+
+func TestSQSConsumer_DeleteMessageWithoutRecords(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := &fakeSQS{}
+	location := Location{Bucket: "bucket", Prefix: "images/"}
+	consumer := NewSQSConsumer(client, nil, SQSConfig{QueueURL: "queue"}, ReaderConfig{}, []Location{location})
+	defer consumer.Stop()
+	consumer.Subscribe(location)
+
+	is.NoErr(consumer.handleMessage(ctx, testS3Event, aws.String("message-1")))
+	is.Equal(client.deletedMessages(), []string{"message-1"})
+}
+
+func TestSQSConsumer_DeleteMessageWithoutRecordsFails(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := &fakeSQS{deleteErr: errors.New("access denied")}
+	location := Location{Bucket: "bucket", Prefix: "images/"}
+	consumer := NewSQSConsumer(client, nil, SQSConfig{QueueURL: "queue"}, ReaderConfig{}, []Location{location})
+	defer consumer.Stop()
+	consumer.Subscribe(location)
+
+	// the failed delete doesn't stop the consumer, the message is read again
+	is.NoErr(consumer.handleMessage(ctx, testS3Event, aws.String("message-1")))
+	is.Equal(client.deletedMessages(), []string(nil))
+	is.NoErr(consumer.handleMessage(ctx, `{"Service":"Amazon S3","Event":"s3:TestEvent"}`, aws.String("message-2")))
+}
+
+func TestSQSConsumer_ExtendVisibilityUntilAck(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := &fakeSQS{}
+	location := Location{Bucket: "bucket", Prefix: "logs/"}
+	consumer := NewSQSConsumer(client, nil, SQSConfig{QueueURL: "queue"}, ReaderConfig{}, []Location{location})
+	defer consumer.Stop()
+	it := consumer.Subscribe(location)
+
+	is.NoErr(consumer.handleMessage(ctx, testS3Event, aws.String("message-1")))
+	_, ack, err := it.Next(ctx)
+	is.NoErr(err)
+
+	consumer.extend(ctx)
+	is.Equal(client.changedMessages(), []string{"message-1"})
+
+	// acked messages are deleted instead of extended
+	is.NoErr(ack(ctx))
+	consumer.extend(ctx)
+	is.Equal(client.changedMessages(), []string{"message-1"})
+}
+
+func TestSQSConsumer_SkipMessageWithInvalidEvent(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := &fakeSQS{}
+	location := Location{Bucket: "bucket", Prefix: "logs/"}
+	consumer := NewSQSConsumer(client, nil, SQSConfig{QueueURL: "queue"}, ReaderConfig{}, []Location{location})
+	defer consumer.Stop()
+	it := consumer.Subscribe(location)
+
+	body := `{"Records":[
+	{"eventName":"ObjectRemoved:Delete","eventTime":"2024-01-02T03:04:05.000Z","s3":{"bucket":{"name":"bucket"},"object":{"key":"logs/a.json"}}},
+	{"eventName":"ObjectRemoved:Delete","eventTime":"2024-01-02T03:04:05.000Z","s3":{"bucket":{"name":"bucket"},"object":{"key":"logs/%zz.json"}}}
+]}`
+	// the invalid key doesn't stop the consumer
+	is.NoErr(consumer.handleMessage(ctx, body, aws.String("message-1")))
+
+	// the message is neither deleted nor extended, so it is delivered again
+	_, ack, err := it.Next(ctx)
+	is.NoErr(err)
+	is.NoErr(ack(ctx))
+	consumer.extend(ctx)
+	is.Equal(client.deletedMessages(), []string(nil))
+	is.Equal(client.changedMessages(), []string(nil))
+}
@@ -0,0 +1,59 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package position
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+)
+
+const (
+	snapshotPrefixChar = 's'
+	cdcPrefixChar      = 'c'
+)
+
+// parseLegacyPosition parses a position in the format used before positions
+// were encoded as JSON: the key, an underscore, "s" or "c" for the type and
+// the timestamp in seconds.
+func parseLegacyPosition(p opencdc.Position) (Position, error) {
+	s := string(p)
+	index := strings.LastIndex(s, "_")
+	if index == -1 {
+		return Position{}, errors.New("invalid position format, no '_' found")
+	}
+	if len(s) < index+2 || (s[index+1] != cdcPrefixChar && s[index+1] != snapshotPrefixChar) {
+		return Position{}, fmt.Errorf("invalid position format, no '%c' or '%c' after '_'", snapshotPrefixChar, cdcPrefixChar)
+	}
+	pType := TypeSnapshot
+	if s[index+1] == cdcPrefixChar {
+		pType = TypeCDC
+	}
+
+	seconds, err := strconv.ParseInt(s[index+2:], 10, 64)
+	if err != nil {
+		return Position{}, fmt.Errorf("could not parse the position timestamp: %w", err)
+	}
+
+	return Position{
+		Key:       s[:index],
+		Timestamp: time.Unix(seconds, 0),
+		Type:      pType,
+	}, nil
+}
@@ -15,10 +15,8 @@
 package position
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/conduitio/conduit-commons/opencdc"
@@ -29,55 +27,121 @@ const (
 	TypeCDC
 )
 
+type Type int
+
+// version is the current version of the position format. Positions are
+// encoded as JSON objects containing the version, so fields can be added
+// without breaking existing positions.
+const version = 1
+
 const (
-	snapshotPrefixChar = 's'
-	cdcPrefixChar      = 'c'
+	snapshotTypeName = "snapshot"
+	cdcTypeName      = "cdc"
 )
 
-type Type int
-
 type Position struct {
 	Key       string
 	Timestamp time.Time
 	Type      Type
+	// SnapshotStart is the time the snapshot started, it is only set in
+	// snapshot positions and carried over when a snapshot is resumed, so
+	// the CDC iterator knows from which point on it needs to capture changes.
+	SnapshotStart time.Time
+	// Line is the 1-based line (or row) number of the record inside the
+	// object when objects are split into multiple records, 0 means the whole
+	// object.
+	Line int64
+	// VersionID is the version of the object in CDC positions, together with
+	// the timestamp and key it orders changes made in the same second.
+	VersionID string
 }
 
+// positionJSON is the format positions are stored in.
+type positionJSON struct {
+	Version       int        `json:"v"`
+	Type          string     `json:"type"`
+	Key           string     `json:"key,omitempty"`
+	Timestamp     time.Time  `json:"timestamp"`
+	SnapshotStart *time.Time `json:"snapshotStart,omitempty"`
+	Line          int64      `json:"line,omitempty"`
+	VersionID     string     `json:"versionId,omitempty"`
+}
+
+// ParseRecordPosition parses a position created by ToRecordPosition, positions
+// in the legacy format ("key_c1634049397") are still accepted, so pipelines
+// keep their progress after an upgrade.
 func ParseRecordPosition(p opencdc.Position) (Position, error) {
 	if p == nil {
 		// empty Position would have the fields with their default values
 		return Position{}, nil
 	}
-	s := string(p)
-	index := strings.LastIndex(s, "_")
-	if index == -1 {
-		return Position{}, errors.New("invalid position format, no '_' found")
-	}
-	seconds, err := strconv.ParseInt(s[index+2:], 10, 64)
-	if err != nil {
-		return Position{}, fmt.Errorf("could not parse the position timestamp: %w", err)
+	if !isJSON(p) {
+		return parseLegacyPosition(p)
 	}
 
-	if s[index+1] != cdcPrefixChar && s[index+1] != snapshotPrefixChar {
-		return Position{}, fmt.Errorf("invalid position format, no '%c' or '%c' after '_'", snapshotPrefixChar, cdcPrefixChar)
+	var pj positionJSON
+	if err := json.Unmarshal(p, &pj); err != nil {
+		return Position{}, fmt.Errorf("could not parse position: %w", err)
 	}
-	pType := TypeSnapshot
-	if s[index+1] == cdcPrefixChar {
-		pType = TypeCDC
+	if pj.Version < 1 || pj.Version > version {
+		return Position{}, fmt.Errorf("unsupported position version %d", pj.Version)
 	}
 
-	return Position{
-		Key:       s[:index],
-		Timestamp: time.Unix(seconds, 0),
-		Type:      pType,
-	}, err
+	pos := Position{
+		Key:       pj.Key,
+		Timestamp: localTime(pj.Timestamp),
+		Line:      pj.Line,
+		VersionID: pj.VersionID,
+	}
+	switch pj.Type {
+	case snapshotTypeName:
+		pos.Type = TypeSnapshot
+	case cdcTypeName:
+		pos.Type = TypeCDC
+	default:
+		return Position{}, fmt.Errorf("invalid position type %q", pj.Type)
+	}
+	if pj.SnapshotStart != nil {
+		pos.SnapshotStart = localTime(*pj.SnapshotStart)
+	}
+	return pos, nil
 }
 
+// ToRecordPosition encodes the position as a JSON object.
 func (p Position) ToRecordPosition() opencdc.Position {
-	char := snapshotPrefixChar
+	pj := positionJSON{
+		Version:   version,
+		Type:      snapshotTypeName,
+		Key:       p.Key,
+		Timestamp: p.Timestamp.UTC(),
+		Line:      p.Line,
+		VersionID: p.VersionID,
+	}
 	if p.Type == TypeCDC {
-		char = cdcPrefixChar
+		pj.Type = cdcTypeName
+	}
+	if p.Type == TypeSnapshot && !p.SnapshotStart.IsZero() {
+		start := p.SnapshotStart.UTC()
+		pj.SnapshotStart = &start
+	}
+	// marshalling strings, numbers and timestamps can't fail
+	b, _ := json.Marshal(pj)
+	return b
+}
+
+// isJSON returns true if the position is a JSON object, legacy positions
+// start with the object key, which can't be a valid JSON object.
+func isJSON(p opencdc.Position) bool {
+	return len(p) > 0 && p[0] == '{' && json.Valid(p)
+}
+
+// localTime returns the time in the local time zone, like the timestamps of
+// legacy positions, the zero time is kept as is.
+func localTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
 	}
-	return []byte(fmt.Sprintf("%s_%c%d", p.Key, char, p.Timestamp.Unix()))
+	return t.Local()
 }
 
 func ConvertToCDCPosition(p opencdc.Position) (opencdc.Position, error) {
@@ -86,5 +150,6 @@ func ConvertToCDCPosition(p opencdc.Position) (opencdc.Position, error) {
 		return opencdc.Position{}, err
 	}
 	cdcPos.Type = TypeCDC
+	cdcPos.SnapshotStart = time.Time{}
 	return cdcPos.ToRecordPosition(), nil
 }
@@ -67,6 +67,53 @@ func Test_ParseRecordPosition(t *testing.T) {
 			in:      []byte("test_88invalid"),
 			out:     Position{},
 		},
+		{
+			name:    "json position",
+			wantErr: false,
+			in:      []byte(`{"v":1,"type":"cdc","key":"a_c1","timestamp":"1970-01-01T00:00:59Z","line":7,"versionId":"v1"}`),
+			out: Position{
+				Key:       "a_c1",
+				Type:      TypeCDC,
+				Timestamp: time.Unix(59, 0),
+				Line:      7,
+				VersionID: "v1",
+			},
+		},
+		{
+			name:    "json position with snapshot start",
+			wantErr: false,
+			in:      []byte(`{"v":1,"type":"snapshot","key":"test","timestamp":"1970-01-01T00:00:59Z","snapshotStart":"1970-01-01T00:00:42Z"}`),
+			out: Position{
+				Key:           "test",
+				Type:          TypeSnapshot,
+				Timestamp:     time.Unix(59, 0),
+				SnapshotStart: time.Unix(42, 0),
+			},
+		},
+		{
+			name:    "unsupported json position version returns error",
+			wantErr: true,
+			in:      []byte(`{"v":2,"type":"cdc","timestamp":"1970-01-01T00:00:59Z"}`),
+			out:     Position{},
+		},
+		{
+			name:    "invalid json position type returns error",
+			wantErr: true,
+			in:      []byte(`{"v":1,"type":"other","timestamp":"1970-01-01T00:00:59Z"}`),
+			out:     Position{},
+		},
+		{
+			name:    "invalid line returns error",
+			wantErr: true,
+			in:      []byte("test_c59:invalid"),
+			out:     Position{},
+		},
+		{
+			name:    "invalid snapshot start returns error",
+			wantErr: true,
+			in:      []byte("test_s59.invalid"),
+			out:     Position{},
+		},
 	}
 
 	for _, tt := range positionTests {
@@ -96,13 +143,13 @@ func Test_ToRecordPosition(t *testing.T) {
 				Type:      TypeSnapshot,
 				Timestamp: time.Unix(0, 0),
 			},
-			out: []byte("test_s0"),
+			out: []byte(`{"v":1,"type":"snapshot","key":"test","timestamp":"1970-01-01T00:00:00Z"}`),
 		},
 		{
 			name:    "empty position returns the zero value for time.Time",
 			wantErr: false,
 			in:      Position{},
-			out:     []byte("_s-62135596800"),
+			out:     []byte(`{"v":1,"type":"snapshot","timestamp":"0001-01-01T00:00:00Z"}`),
 		},
 		{
 			name:    "cdc type position",
@@ -112,7 +159,41 @@ func Test_ToRecordPosition(t *testing.T) {
 				Type:      TypeCDC,
 				Timestamp: time.Unix(59, 0),
 			},
-			out: []byte("test_c59"),
+			out: []byte(`{"v":1,"type":"cdc","key":"test","timestamp":"1970-01-01T00:00:59Z"}`),
+		},
+		{
+			name:    "snapshot position with snapshot start",
+			wantErr: false,
+			in: Position{
+				Key:           "test",
+				Type:          TypeSnapshot,
+				Timestamp:     time.Unix(59, 0),
+				SnapshotStart: time.Unix(42, 0),
+			},
+			out: []byte(`{"v":1,"type":"snapshot","key":"test","timestamp":"1970-01-01T00:00:59Z","snapshotStart":"1970-01-01T00:00:42Z"}`),
+		},
+		{
+			name:    "snapshot position with line",
+			wantErr: false,
+			in: Position{
+				Key:           "test",
+				Type:          TypeSnapshot,
+				Timestamp:     time.Unix(59, 0),
+				SnapshotStart: time.Unix(42, 0),
+				Line:          7,
+			},
+			out: []byte(`{"v":1,"type":"snapshot","key":"test","timestamp":"1970-01-01T00:00:59Z","snapshotStart":"1970-01-01T00:00:42Z","line":7}`),
+		},
+		{
+			name:    "cdc position with version ID",
+			wantErr: false,
+			in: Position{
+				Key:       "test",
+				Type:      TypeCDC,
+				Timestamp: time.Unix(59, 0),
+				VersionID: "v1_a:b.c",
+			},
+			out: []byte(`{"v":1,"type":"cdc","key":"test","timestamp":"1970-01-01T00:00:59Z","versionId":"v1_a:b.c"}`),
 		},
 	}
 
@@ -127,6 +208,23 @@ func Test_ToRecordPosition(t *testing.T) {
 	}
 }
 
+func TestPosition_RoundTrip(t *testing.T) {
+	want := []Position{
+		{},
+		{Key: "key_with_s1_underscores", Type: TypeSnapshot, Timestamp: time.Unix(59, 123456789), SnapshotStart: time.Unix(42, 0)},
+		{Key: "{\"key\":1}", Type: TypeCDC, Timestamp: time.Unix(59, 1000000), Line: 3, VersionID: "v1_a:b.c"},
+	}
+	for _, p := range want {
+		got, err := ParseRecordPosition(p.ToRecordPosition())
+		if err != nil {
+			t.Fatalf("ParseRecordPosition() error = %v", err)
+		}
+		if got != p {
+			t.Errorf("ParseRecordPosition(): Got : %v,Expected : %v", got, p)
+		}
+	}
+}
+
 func Test_ConvertSnapshotPositionToCDC(t *testing.T) {
 	positionTests := []struct {
 		name    string
@@ -138,7 +236,7 @@ func Test_ConvertSnapshotPositionToCDC(t *testing.T) {
 			name:    "convert snapshot position to cdc",
 			wantErr: false,
 			in:      []byte("test_s100"),
-			out:     []byte("test_c100"),
+			out:     []byte(`{"v":1,"type":"cdc","key":"test","timestamp":"1970-01-01T00:01:40Z"}`),
 		},
 		{
 			name:    "convert invalid snapshot should produce error",
@@ -0,0 +1,98 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package position
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+)
+
+// Positions contains the position of each collection (bucket and prefix
+// pair) read by the source, keyed by the collection name. Collections that
+// weren't read yet don't have a position.
+type Positions map[string]Position
+
+// positionsJSON is the format Positions are stored in, each position is
+// stored in the format of Position.ToRecordPosition. Positions created before
+// positions were encoded as JSON contain the legacy positions as strings.
+type positionsJSON struct {
+	Version     int                        `json:"v,omitempty"`
+	Collections map[string]json.RawMessage `json:"collections"`
+}
+
+// ParseRecordPositions parses a record position containing the positions of
+// multiple collections. A position of a single collection, e.g. one created
+// before multiple collections were supported, is returned as the position of
+// defaultCollection.
+func ParseRecordPositions(p opencdc.Position, defaultCollection string) (Positions, error) {
+	if p == nil {
+		return Positions{}, nil
+	}
+	if !isJSON(p) {
+		single, err := ParseRecordPosition(p)
+		if err != nil {
+			return nil, err
+		}
+		return Positions{defaultCollection: single}, nil
+	}
+
+	var pj positionsJSON
+	if err := json.Unmarshal(p, &pj); err != nil {
+		return nil, fmt.Errorf("could not parse positions: %w", err)
+	}
+	if pj.Collections == nil {
+		// a position of a single collection in the JSON format
+		single, err := ParseRecordPosition(p)
+		if err != nil {
+			return nil, err
+		}
+		return Positions{defaultCollection: single}, nil
+	}
+	if pj.Version > version {
+		return nil, fmt.Errorf("unsupported position version %d", pj.Version)
+	}
+
+	positions := make(Positions, len(pj.Collections))
+	for collection, raw := range pj.Collections {
+		rp := opencdc.Position(raw)
+		var legacy string
+		if json.Unmarshal(raw, &legacy) == nil {
+			rp = opencdc.Position(legacy)
+		}
+		single, err := ParseRecordPosition(rp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid position of collection %q: %w", collection, err)
+		}
+		positions[collection] = single
+	}
+	return positions, nil
+}
+
+// ToRecordPosition returns the record position containing the positions of
+// all collections.
+func (p Positions) ToRecordPosition() opencdc.Position {
+	pj := positionsJSON{
+		Version:     version,
+		Collections: make(map[string]json.RawMessage, len(p)),
+	}
+	for collection, single := range p {
+		pj.Collections[collection] = json.RawMessage(single.ToRecordPosition())
+	}
+	// marshalling a map of valid JSON objects can't fail
+	b, _ := json.Marshal(pj)
+	return b
+}
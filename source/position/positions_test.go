@@ -0,0 +1,64 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package position
+
+import (
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func TestPositions_RoundTrip(t *testing.T) {
+	is := is.New(t)
+	want := Positions{
+		"bucket/a/": {Key: "a/file", Timestamp: time.Unix(1634049397, 0), Type: TypeCDC},
+		"bucket/b/": {Key: "b/file", Timestamp: time.Unix(1634049398, 0), Type: TypeSnapshot, SnapshotStart: time.Unix(1634049399, 0), Line: 3},
+	}
+
+	got, err := ParseRecordPositions(want.ToRecordPosition(), "bucket/a/")
+	is.NoErr(err)
+	is.Equal(got, want)
+}
+
+func TestParseRecordPositions_SinglePosition(t *testing.T) {
+	is := is.New(t)
+	p := Position{Key: "file", Timestamp: time.Unix(1634049397, 0), Type: TypeCDC}
+
+	got, err := ParseRecordPositions(p.ToRecordPosition(), "bucket")
+	is.NoErr(err)
+	is.Equal(got, Positions{"bucket": p})
+}
+
+func TestParseRecordPositions_LegacyPositions(t *testing.T) {
+	is := is.New(t)
+	got, err := ParseRecordPositions(opencdc.Position(`{"collections":{"bucket/a/":"a/file_c1634049397"}}`), "bucket")
+	is.NoErr(err)
+	is.Equal(got, Positions{"bucket/a/": {Key: "a/file", Timestamp: time.Unix(1634049397, 0), Type: TypeCDC}})
+}
+
+func TestParseRecordPositions_Nil(t *testing.T) {
+	is := is.New(t)
+	got, err := ParseRecordPositions(nil, "bucket")
+	is.NoErr(err)
+	is.Equal(got, Positions{})
+}
+
+func TestParseRecordPositions_Invalid(t *testing.T) {
+	is := is.New(t)
+	_, err := ParseRecordPositions(opencdc.Position(`{"collections":{"bucket":"invalid"}}`), "bucket")
+	is.True(err != nil)
+}
@@ -0,0 +1,332 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/conduitio/conduit-connector-s3/source/iterator"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// PostProcessAction defines what happens to objects once all records read
+// from them are acknowledged.
+type PostProcessAction string
+
+const (
+	// PostProcessNone leaves processed objects as they are.
+	PostProcessNone PostProcessAction = "none"
+	// PostProcessTag adds a tag to processed objects.
+	PostProcessTag PostProcessAction = "tag"
+	// PostProcessMove copies processed objects to the archive prefix and
+	// deletes them.
+	PostProcessMove PostProcessAction = "move"
+	// PostProcessDelete deletes processed objects.
+	PostProcessDelete PostProcessAction = "delete"
+)
+
+// postProcessMetrics counts the post-processing actions by action and
+// outcome, e.g. "tag.succeeded" or "move.failed".
+var postProcessMetrics = expvar.NewMap("conduit_connector_s3_source_post_process")
+
+// PostProcessConfig contains the options for post-processing objects.
+type PostProcessConfig struct {
+	// what happens to an object once all records read from it are
+	// acknowledged, "none" leaves it as it is, "tag" adds postProcess.tag
+	// to it, "move" copies it to postProcess.archivePrefix and deletes it,
+	// "delete" deletes it. In versioned buckets only the version that was
+	// read is deleted, newer versions are kept. Failed actions are logged and
+	// don't stop the pipeline. "move" and "delete" can't be combined with
+	// cdc.mode "unversioned".
+	Action PostProcessAction `json:"action" default:"none" validate:"inclusion=none|tag|move|delete"`
+	// tag added to processed objects as "key=value", only used if the action
+	// is "tag". Other tags of the object are kept.
+	Tag string `json:"tag" default:"conduit-processed=true"`
+	// prefix processed objects are moved to, the object key is appended to
+	// it (e.g. "archive/" moves "logs/a.json" to "archive/logs/a.json"). Only
+	// used if the action is "move", archived objects can't be inside a
+	// location that is read.
+	ArchivePrefix string `json:"archivePrefix"`
+	// bucket processed objects are moved to, defaults to the bucket the
+	// object was read from.
+	ArchiveBucket string `json:"archiveBucket"`
+}
+
+// validate checks the action's options, archived objects are not allowed in
+// the read locations, as they would be read again. Objects can't be moved or
+// deleted with the CDC mode "unversioned", the next scan would produce a
+// delete record for each of them.
+func (c PostProcessConfig) validate(locations []iterator.Location, mode CDCMode) error {
+	if mode == CDCModeUnversioned && (c.Action == PostProcessMove || c.Action == PostProcessDelete) {
+		return fmt.Errorf("%q %q can't be combined with %q %q, processed objects would be read as deleted", ConfigKeyPostProcessAction, c.Action, ConfigKeyCDCMode, CDCModeUnversioned)
+	}
+	switch c.Action {
+	case PostProcessTag:
+		if _, _, err := c.tag(); err != nil {
+			return err
+		}
+	case PostProcessMove:
+		if c.ArchivePrefix == "" && c.ArchiveBucket == "" {
+			return fmt.Errorf("%q or %q is required if %q is %q", ConfigKeyPostProcessArchivePrefix, ConfigKeyPostProcessArchiveBucket, ConfigKeyPostProcessAction, PostProcessMove)
+		}
+		for _, from := range locations {
+			to := iterator.Location{Bucket: c.archiveBucket(from.Bucket), Prefix: c.ArchivePrefix + from.Prefix}
+			for _, l := range locations {
+				if l.Bucket == to.Bucket && (strings.HasPrefix(to.Prefix, l.Prefix) || strings.HasPrefix(l.Prefix, to.Prefix)) {
+					return fmt.Errorf("%q: objects of %q would be moved to %q, which is read by location %q", ConfigKeyPostProcessArchivePrefix, from.Collection(), to.Collection(), l.Collection())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tag returns the key and value of the tag added to processed objects.
+func (c PostProcessConfig) tag() (string, string, error) {
+	key, value, ok := strings.Cut(c.Tag, "=")
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("%q: invalid tag %q, expected \"key=value\"", ConfigKeyPostProcessTag, c.Tag)
+	}
+	return key, value, nil
+}
+
+func (c PostProcessConfig) archiveBucket(bucket string) string {
+	if c.ArchiveBucket != "" {
+		return c.ArchiveBucket
+	}
+	return bucket
+}
+
+// postProcessQueueSize is the number of processed objects waiting for their
+// action, acks block once the queue is full.
+const postProcessQueueSize = 1000
+
+// postProcessClient contains the S3 operations used to post-process objects.
+type postProcessClient interface {
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// postProcessor runs the configured action on processed objects in the
+// background, so slow actions (e.g. copying large objects) don't hold up
+// acks.
+type postProcessor struct {
+	config PostProcessConfig
+	client postProcessClient
+
+	objects  chan iterator.AckedObject
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+// newPostProcessor returns a postProcessor and starts its worker, which runs
+// until stop is called. The logger of ctx is used to log failed actions.
+func newPostProcessor(ctx context.Context, config PostProcessConfig, client postProcessClient) *postProcessor {
+	p := &postProcessor{
+		config:   config,
+		client:   client,
+		objects:  make(chan iterator.AckedObject, postProcessQueueSize),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	// the worker outlives the context of Open
+	go p.run(sdk.Logger(ctx).WithContext(context.Background()))
+	return p
+}
+
+// objectAcked queues the action of an object of which all records were
+// acknowledged.
+func (p *postProcessor) objectAcked(ctx context.Context, o iterator.AckedObject) error {
+	select {
+	case <-p.stopping:
+		sdk.Logger(ctx).Warn().
+			Str("bucket", o.Bucket).
+			Str("key", o.Key).
+			Msg("not post-processing object acknowledged after stopping")
+		return nil
+	default:
+	}
+
+	select {
+	case p.objects <- o:
+		return nil
+	case <-p.stopping:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run runs the actions of queued objects until the postProcessor is stopped,
+// the objects queued by then are processed before it returns.
+func (p *postProcessor) run(ctx context.Context) {
+	defer close(p.done)
+	for {
+		select {
+		case o := <-p.objects:
+			p.process(ctx, o)
+		case <-p.stopping:
+			for {
+				select {
+				case o := <-p.objects:
+					p.process(ctx, o)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stop stops the worker and waits until the queued objects are processed,
+// or until ctx is done.
+func (p *postProcessor) stop(ctx context.Context) error {
+	close(p.stopping)
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("could not post-process all acknowledged objects: %w", ctx.Err())
+	}
+}
+
+// process runs the action on an object. Errors are logged and counted instead
+// of being returned, a failed action doesn't mean the records weren't
+// delivered.
+func (p *postProcessor) process(ctx context.Context, o iterator.AckedObject) {
+	var err error
+	switch p.config.Action {
+	case PostProcessTag:
+		err = p.tag(ctx, o)
+	case PostProcessMove:
+		err = p.move(ctx, o)
+	case PostProcessDelete:
+		err = p.delete(ctx, o)
+	default:
+		return
+	}
+
+	if err != nil {
+		postProcessMetrics.Add(string(p.config.Action)+".failed", 1)
+		sdk.Logger(ctx).Error().Err(err).
+			Str("action", string(p.config.Action)).
+			Str("bucket", o.Bucket).
+			Str("key", o.Key).
+			Str("versionId", o.VersionID).
+			Msg("could not post-process object")
+		return
+	}
+	postProcessMetrics.Add(string(p.config.Action)+".succeeded", 1)
+}
+
+// tag adds the tag to the object, keeping its other tags.
+func (p *postProcessor) tag(ctx context.Context, o iterator.AckedObject) error {
+	key, value, err := p.config.tag()
+	if err != nil {
+		return err
+	}
+	out, err := p.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket:    aws.String(o.Bucket),
+		Key:       aws.String(o.Key),
+		VersionId: versionID(o),
+	})
+	if err != nil {
+		return fmt.Errorf("could not get tags: %w", err)
+	}
+
+	tags := []types.Tag{{Key: aws.String(key), Value: aws.String(value)}}
+	for _, t := range out.TagSet {
+		if aws.ToString(t.Key) != key {
+			tags = append(tags, t)
+		}
+	}
+	_, err = p.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:    aws.String(o.Bucket),
+		Key:       aws.String(o.Key),
+		VersionId: versionID(o),
+		Tagging:   &types.Tagging{TagSet: tags},
+	})
+	if err != nil {
+		return fmt.Errorf("could not put tags: %w", err)
+	}
+	return nil
+}
+
+// move copies the object to the archive and deletes it, the copy keeps the
+// object's metadata and tags. Objects larger than 5 GB can't be copied in a
+// single request, so they can't be moved.
+func (p *postProcessor) move(ctx context.Context, o iterator.AckedObject) error {
+	source := escapeKey(o.Bucket + "/" + o.Key)
+	if o.VersionID != "" {
+		source += "?versionId=" + url.QueryEscape(o.VersionID)
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(p.config.archiveBucket(o.Bucket)),
+		Key:        aws.String(p.config.ArchivePrefix + o.Key),
+		CopySource: aws.String(source),
+	}
+	if o.VersionID == "" && o.ETag != "" {
+		// don't archive contents that were not read
+		input.CopySourceIfMatch = aws.String(o.ETag)
+	}
+	if _, err := p.client.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("could not copy object to the archive: %w", err)
+	}
+	return p.delete(ctx, o)
+}
+
+// delete deletes the version that was read, newer versions are kept. Objects
+// in buckets without versioning are only deleted if they weren't overwritten
+// since they were read.
+func (p *postProcessor) delete(ctx context.Context, o iterator.AckedObject) error {
+	input := &s3.DeleteObjectInput{
+		Bucket:    aws.String(o.Bucket),
+		Key:       aws.String(o.Key),
+		VersionId: versionID(o),
+	}
+	if o.VersionID == "" && o.ETag != "" {
+		input.IfMatch = aws.String(o.ETag)
+	}
+	_, err := p.client.DeleteObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("could not delete object: %w", err)
+	}
+	return nil
+}
+
+func versionID(o iterator.AckedObject) *string {
+	if o.VersionID == "" {
+		return nil
+	}
+	return aws.String(o.VersionID)
+}
+
+// escapeKey URL encodes each segment of a key, keeping the slashes.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
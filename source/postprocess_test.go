@@ -0,0 +1,231 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/conduitio/conduit-connector-s3/source/iterator"
+	"github.com/matryer/is"
+)
+
+// fakePostProcessS3 is a postProcessClient recording the inputs of its calls,
+// copies block until release is closed if it is set.
+type fakePostProcessS3 struct {
+	m       sync.Mutex
+	calls   []any
+	tags    []types.Tag
+	release chan struct{}
+}
+
+func (f *fakePostProcessS3) record(in any) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.calls = append(f.calls, in)
+}
+
+func (f *fakePostProcessS3) recorded() []any {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return append([]any(nil), f.calls...)
+}
+
+func (f *fakePostProcessS3) GetObjectTagging(_ context.Context, in *s3.GetObjectTaggingInput, _ ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	f.record(in)
+	return &s3.GetObjectTaggingOutput{TagSet: f.tags}, nil
+}
+
+func (f *fakePostProcessS3) PutObjectTagging(_ context.Context, in *s3.PutObjectTaggingInput, _ ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	f.record(in)
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func (f *fakePostProcessS3) CopyObject(_ context.Context, in *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.record(in)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakePostProcessS3) DeleteObject(_ context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.record(in)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestPostProcessConfig_Validate(t *testing.T) {
+	locations := []iterator.Location{{Bucket: "bucket", Prefix: "logs/"}, {Bucket: "bucket", Prefix: "events/"}}
+
+	testCases := []struct {
+		name    string
+		config  PostProcessConfig
+		mode    CDCMode
+		wantErr bool
+	}{{
+		name:   "none",
+		config: PostProcessConfig{Action: PostProcessNone},
+	}, {
+		name:   "tag",
+		config: PostProcessConfig{Action: PostProcessTag, Tag: "conduit-processed=true"},
+	}, {
+		name:    "invalid tag",
+		config:  PostProcessConfig{Action: PostProcessTag, Tag: "conduit-processed"},
+		wantErr: true,
+	}, {
+		name:   "move to archive prefix",
+		config: PostProcessConfig{Action: PostProcessMove, ArchivePrefix: "archive/"},
+	}, {
+		name:   "move to archive bucket",
+		config: PostProcessConfig{Action: PostProcessMove, ArchiveBucket: "archive"},
+	}, {
+		name:    "move without archive",
+		config:  PostProcessConfig{Action: PostProcessMove},
+		wantErr: true,
+	}, {
+		name:    "move into read location",
+		config:  PostProcessConfig{Action: PostProcessMove, ArchivePrefix: "logs/"},
+		wantErr: true,
+	}, {
+		name:    "move into other read location",
+		config:  PostProcessConfig{Action: PostProcessMove, ArchivePrefix: "events/"},
+		wantErr: true,
+	}, {
+		name:   "tag unversioned",
+		config: PostProcessConfig{Action: PostProcessTag, Tag: "conduit-processed=true"},
+		mode:   CDCModeUnversioned,
+	}, {
+		name:    "move unversioned",
+		config:  PostProcessConfig{Action: PostProcessMove, ArchivePrefix: "archive/"},
+		mode:    CDCModeUnversioned,
+		wantErr: true,
+	}, {
+		name:    "delete unversioned",
+		config:  PostProcessConfig{Action: PostProcessDelete},
+		mode:    CDCModeUnversioned,
+		wantErr: true,
+	}, {
+		name:   "delete sqs",
+		config: PostProcessConfig{Action: PostProcessDelete},
+		mode:   CDCModeSQS,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			mode := tc.mode
+			if mode == "" {
+				mode = CDCModePolling
+			}
+			err := tc.config.validate(locations, mode)
+			is.Equal(err != nil, tc.wantErr)
+		})
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	is := is.New(t)
+	is.Equal(escapeKey("bucket/logs/a b+c.json"), "bucket/logs/a%20b+c.json")
+}
+
+func TestPostProcessor_Actions(t *testing.T) {
+	unversioned := iterator.AckedObject{Bucket: "bucket", Key: "logs/a b.json", ETag: `"etag"`}
+	versioned := iterator.AckedObject{Bucket: "bucket", Key: "logs/a.json", VersionID: "v1", ETag: `"etag"`}
+
+	testCases := []struct {
+		name   string
+		config PostProcessConfig
+		object iterator.AckedObject
+		want   []any
+	}{{
+		name:   "tag",
+		config: PostProcessConfig{Action: PostProcessTag, Tag: "conduit-processed=true"},
+		object: versioned,
+		want: []any{
+			&s3.GetObjectTaggingInput{Bucket: aws.String("bucket"), Key: aws.String("logs/a.json"), VersionId: aws.String("v1")},
+			&s3.PutObjectTaggingInput{
+				Bucket:    aws.String("bucket"),
+				Key:       aws.String("logs/a.json"),
+				VersionId: aws.String("v1"),
+				Tagging: &types.Tagging{TagSet: []types.Tag{
+					{Key: aws.String("conduit-processed"), Value: aws.String("true")},
+					{Key: aws.String("owner"), Value: aws.String("team")},
+				}},
+			},
+		},
+	}, {
+		name:   "move",
+		config: PostProcessConfig{Action: PostProcessMove, ArchivePrefix: "archive/", ArchiveBucket: "archive"},
+		object: unversioned,
+		want: []any{
+			&s3.CopyObjectInput{
+				Bucket:            aws.String("archive"),
+				Key:               aws.String("archive/logs/a b.json"),
+				CopySource:        aws.String("bucket/logs/a%20b.json"),
+				CopySourceIfMatch: aws.String(`"etag"`),
+			},
+			&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("logs/a b.json"), IfMatch: aws.String(`"etag"`)},
+		},
+	}, {
+		name:   "delete version",
+		config: PostProcessConfig{Action: PostProcessDelete},
+		object: versioned,
+		want: []any{
+			&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("logs/a.json"), VersionId: aws.String("v1")},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			client := &fakePostProcessS3{tags: []types.Tag{
+				{Key: aws.String("owner"), Value: aws.String("team")},
+				{Key: aws.String("conduit-processed"), Value: aws.String("false")},
+			}}
+			p := newPostProcessor(ctx, tc.config, client)
+
+			is.NoErr(p.objectAcked(ctx, tc.object))
+			// stopping waits for the queued actions
+			is.NoErr(p.stop(ctx))
+			is.Equal(client.recorded(), tc.want)
+		})
+	}
+}
+
+func TestPostProcessor_AckDoesNotWaitForAction(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := &fakePostProcessS3{release: make(chan struct{})}
+	p := newPostProcessor(ctx, PostProcessConfig{Action: PostProcessMove, ArchivePrefix: "archive/"}, client)
+
+	// the copy of the first object blocks, the acks are queued anyway
+	for _, key := range []string{"logs/a.json", "logs/b.json"} {
+		is.NoErr(p.objectAcked(ctx, iterator.AckedObject{Bucket: "bucket", Key: key}))
+	}
+	is.Equal(len(client.recorded()), 0)
+
+	close(client.release)
+	is.NoErr(p.stop(ctx))
+	is.Equal(len(client.recorded()), 4) // copy and delete per object
+
+	// objects acknowledged after stopping are not processed
+	is.NoErr(p.objectAcked(ctx, iterator.AckedObject{Bucket: "bucket", Key: "logs/c.json"}))
+	is.Equal(len(client.recorded()), 4)
+}
@@ -19,19 +19,20 @@ import (
 	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	awsConfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/conduitio/conduit-commons/lang"
 	"github.com/conduitio/conduit-commons/opencdc"
 	"github.com/conduitio/conduit-connector-s3/source/iterator"
-	"github.com/conduitio/conduit-connector-s3/source/position"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 )
 
 type Iterator interface {
 	HasNext(ctx context.Context) bool
 	Next(ctx context.Context) (opencdc.Record, error)
+	Ack(ctx context.Context, p opencdc.Position) error
+	// InFlight returns the number of records that were read but not
+	// acknowledged yet.
+	InFlight() int
 	Stop()
 }
 
@@ -39,9 +40,10 @@ type Iterator interface {
 type Source struct {
 	sdk.UnimplementedSource
 
-	config   Config
-	iterator Iterator
-	client   *s3.Client
+	config        Config
+	iterator      Iterator
+	client        *s3.Client
+	postProcessor *postProcessor
 }
 
 func NewSource() sdk.Source {
@@ -65,40 +67,53 @@ func (s *Source) Config() sdk.SourceConfig {
 
 // Open prepare the plugin to start sending records from the given position
 func (s *Source) Open(ctx context.Context, rp opencdc.Position) error {
-	awsCredsProvider := credentials.NewStaticCredentialsProvider(
-		s.config.AWSAccessKeyID,
-		s.config.AWSSecretAccessKey,
-		"",
-	)
-
-	s3Config, err := awsConfig.LoadDefaultConfig(
-		ctx,
-		awsConfig.WithRegion(s.config.AWSRegion),
-		awsConfig.WithCredentialsProvider(awsCredsProvider),
-	)
+	var err error
+	s.client, err = s.config.NewS3Client(ctx)
 	if err != nil {
 		return err
 	}
 
-	s.client = s3.NewFromConfig(s3Config)
-
-	// check if bucket exists
-	err = s.bucketExists(ctx, s.config.AWSBucket)
+	locations, err := s.config.ReadLocations()
 	if err != nil {
 		return err
 	}
 
-	// parse position to start from
-	p, err := position.ParseRecordPosition(rp)
+	// check if the buckets exist
+	checked := make(map[string]bool, len(locations))
+	for _, l := range locations {
+		if checked[l.Bucket] {
+			continue
+		}
+		err = s.bucketExists(ctx, l.Bucket)
+		if err != nil {
+			return fmt.Errorf("could not access bucket %q: %w", l.Bucket, err)
+		}
+		checked[l.Bucket] = true
+	}
+
+	readerConfig, err := s.config.ReaderConfig()
 	if err != nil {
 		return err
 	}
+	if s.config.PostProcess.Action != PostProcessNone {
+		s.postProcessor = newPostProcessor(ctx, s.config.PostProcess, s.client)
+		readerConfig.ObjectAcked = s.postProcessor.objectAcked
+	}
 
-	s.iterator, err = iterator.NewCombinedIterator(
-		ctx, s.config.AWSBucket, s.config.Prefix, s.config.PollingPeriod, s.client, p,
+	var sqsConsumer *iterator.SQSConsumer
+	if s.config.CDC.Mode == CDCModeSQS {
+		sqsClient, err := s.config.NewSQSClient(ctx, s.config.CDC.SQS.Endpoint)
+		if err != nil {
+			return err
+		}
+		sqsConsumer = iterator.NewSQSConsumer(sqsClient, s.client, s.config.CDC.SQS.ConsumerConfig(), readerConfig, locations)
+	}
+
+	s.iterator, err = iterator.NewMultiIterator(
+		ctx, locations, s.config.SnapshotIteratorConfig(), s.config.CDCIteratorConfig(), readerConfig, s.client, sqsConsumer, rp,
 	)
 	if err != nil {
-		return fmt.Errorf("couldn't create a combined iterator: %w", err)
+		return fmt.Errorf("couldn't create the iterator: %w", err)
 	}
 	return nil
 }
@@ -115,10 +130,21 @@ func (s *Source) Read(ctx context.Context) (opencdc.Record, error) {
 	return r, nil
 }
 
-func (s *Source) Teardown(_ context.Context) error {
+func (s *Source) Teardown(ctx context.Context) error {
 	if s.iterator != nil {
+		if n := s.iterator.InFlight(); n > 0 {
+			// the records are read again after a restart, reading starts
+			// from the position of the last acknowledged record
+			sdk.Logger(ctx).Warn().
+				Int("records", n).
+				Msg("stopping with records that were not acknowledged")
+		}
 		s.iterator.Stop()
 	}
+	if s.postProcessor != nil {
+		// objects acknowledged before stopping are still processed
+		return s.postProcessor.stop(ctx)
+	}
 	return nil
 }
 
@@ -132,5 +158,7 @@ func (s *Source) bucketExists(ctx context.Context, bucketName string) error {
 
 func (s *Source) Ack(ctx context.Context, position opencdc.Position) error {
 	sdk.Logger(ctx).Debug().Str("position", string(position)).Msg("got ack")
-	return nil // no ack needed
+	// the position is only committed once acked, actions tied to processed
+	// records (e.g. deleting SQS messages) run at this point
+	return s.iterator.Ack(ctx, position)
 }
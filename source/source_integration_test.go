@@ -32,6 +32,7 @@ import (
 	s3Conn "github.com/conduitio/conduit-connector-s3"
 	"github.com/conduitio/conduit-connector-s3/config"
 	"github.com/conduitio/conduit-connector-s3/source"
+	"github.com/conduitio/conduit-connector-s3/source/iterator"
 	"github.com/conduitio/conduit-connector-s3/source/position"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/google/uuid"
@@ -79,7 +80,7 @@ func TestSource_SuccessfulSnapshot(t *testing.T) {
 	_ = underTest.Teardown(ctx)
 }
 
-func TestSource_SnapshotRestart(t *testing.T) {
+func TestSource_SnapshotResume(t *testing.T) {
 	is := is.New(t)
 	client, cfg := prepareIntegrationTest(t)
 
@@ -89,21 +90,100 @@ func TestSource_SnapshotRestart(t *testing.T) {
 	err := sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().SourceParams)
 	is.NoErr(err) // failed to parse the configuration
 
-	// set a non nil position
-	err = underTest.Open(ctx, []byte("file3_s0"))
-	is.NoErr(err) // failed to open the source
-
 	testFiles := addObjectsToBucket(ctx, t, testBucket, "", client, 10)
 
+	// resume the snapshot after the fifth file
+	pos := position.Position{
+		Key:           testFiles[4].key,
+		Type:          position.TypeSnapshot,
+		SnapshotStart: time.Now(),
+	}
+	err = underTest.Open(ctx, pos.ToRecordPosition())
+	is.NoErr(err) // failed to open the source
+
 	// read and assert
-	for _, file := range testFiles {
-		// first position is not nil, then snapshot will start from beginning
+	for _, file := range testFiles[5:] {
 		_, err := readAndAssert(ctx, t, underTest, file)
 		is.NoErr(err)
 	}
 	_ = underTest.Teardown(ctx)
 }
 
+func TestSource_SnapshotNewlineSplit(t *testing.T) {
+	is := is.New(t)
+	client, cfg := prepareIntegrationTest(t)
+
+	ctx := context.Background()
+	testBucket := cfg[config.ConfigKeyAWSBucket]
+	cfg[source.ConfigKeySplitMode] = string(iterator.SplitModeNewline)
+	underTest := &source.Source{}
+	err := sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().SourceParams)
+	is.NoErr(err) // failed to parse the configuration
+
+	content := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(testBucket),
+		Key:           aws.String("events.jsonl"),
+		Body:          strings.NewReader(content),
+		ContentLength: aws.Int64(int64(len(content))),
+	})
+	is.NoErr(err)
+
+	// resume after the first line
+	pos := position.Position{
+		Key:           "events.jsonl",
+		Type:          position.TypeSnapshot,
+		SnapshotStart: time.Now(),
+		Line:          1,
+	}
+	err = underTest.Open(ctx, pos.ToRecordPosition())
+	is.NoErr(err) // failed to open the source
+
+	for _, want := range []string{`{"id":2}`, `{"id":3}`} {
+		rec, err := underTest.Read(ctx)
+		is.NoErr(err)
+		is.Equal(string(rec.Key.Bytes()), "events.jsonl")
+		is.Equal(string(rec.Payload.After.Bytes()), want)
+	}
+	_ = underTest.Teardown(ctx)
+}
+
+func TestSource_SnapshotCSV(t *testing.T) {
+	is := is.New(t)
+	client, cfg := prepareIntegrationTest(t)
+
+	ctx := context.Background()
+	testBucket := cfg[config.ConfigKeyAWSBucket]
+	cfg[source.ConfigKeySplitMode] = string(iterator.SplitModeCSV)
+	cfg[source.ConfigKeyCSVColumnTypes] = "id:int"
+	underTest := &source.Source{}
+	err := sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().SourceParams)
+	is.NoErr(err) // failed to parse the configuration
+
+	content := "id,name\n1,foo\n2,bar\n"
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(testBucket),
+		Key:           aws.String("export.csv"),
+		Body:          strings.NewReader(content),
+		ContentLength: aws.Int64(int64(len(content))),
+	})
+	is.NoErr(err)
+
+	err = underTest.Open(ctx, nil)
+	is.NoErr(err) // failed to open the source
+
+	for _, want := range []opencdc.StructuredData{
+		{"id": int64(1), "name": "foo"},
+		{"id": int64(2), "name": "bar"},
+	} {
+		rec, err := underTest.Read(ctx)
+		is.NoErr(err)
+		is.Equal(string(rec.Key.Bytes()), "export.csv")
+		is.Equal(rec.Payload.After, want)
+	}
+	_ = underTest.Teardown(ctx)
+}
+
 func TestSource_EmptyBucket(t *testing.T) {
 	is := is.New(t)
 	_, cfg := prepareIntegrationTest(t)
@@ -274,6 +354,55 @@ func TestSource_CDC_UpdateWithVersioning(t *testing.T) {
 	_ = underTest.Teardown(ctx)
 }
 
+func TestSource_CDC_UpdateWithBefore(t *testing.T) {
+	is := is.New(t)
+	client, cfg := prepareIntegrationTest(t)
+
+	ctx := context.Background()
+	testBucket := cfg[config.ConfigKeyAWSBucket]
+	cfg[source.ConfigKeyCDCBeforeEnabled] = "true"
+	underTest := &source.Source{}
+
+	_, err := client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(testBucket),
+		VersioningConfiguration: &types.VersioningConfiguration{Status: types.BucketVersioningStatusEnabled},
+	})
+	is.NoErr(err) // couldn't create a versioned bucket
+
+	err = sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().SourceParams)
+	is.NoErr(err)
+
+	err = underTest.Open(context.Background(), nil)
+	is.NoErr(err)
+
+	testFiles := addObjectsToBucket(ctx, t, testBucket, "", client, 1)
+	_, err = readAndAssert(ctx, t, underTest, testFiles[0])
+	is.NoErr(err)
+
+	time.Sleep(time.Second)
+
+	content := uuid.NewString()
+	buf := strings.NewReader(content)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(testBucket),
+		Key:           aws.String(testFiles[0].key),
+		Body:          buf,
+		ContentLength: aws.Int64(int64(buf.Len())),
+	})
+	is.NoErr(err)
+
+	obj, err := readWithTimeout(ctx, underTest, time.Second*10)
+	is.NoErr(err)
+
+	// the previous version is attached to the update
+	is.Equal(obj.Operation, opencdc.OperationUpdate)
+	is.Equal(string(obj.Payload.After.Bytes()), content)
+	is.Equal(string(obj.Payload.Before.Bytes()), testFiles[0].content)
+	is.True(obj.Metadata[iterator.MetadataBeforePrefix+iterator.MetadataVersionID] != "")
+
+	_ = underTest.Teardown(ctx)
+}
+
 func TestSource_CDC_DeleteWithVersioning(t *testing.T) {
 	is := is.New(t)
 	client, cfg := prepareIntegrationTest(t)
@@ -325,6 +454,64 @@ func TestSource_CDC_DeleteWithVersioning(t *testing.T) {
 	is.NoErr(err)
 }
 
+func TestSource_CDC_Unversioned(t *testing.T) {
+	is := is.New(t)
+	client, cfg := prepareIntegrationTest(t)
+
+	ctx := context.Background()
+	testBucket := cfg[config.ConfigKeyAWSBucket]
+	cfg[source.ConfigKeyCDCMode] = string(source.CDCModeUnversioned)
+	cfg[source.ConfigKeyCDCIndexDir] = t.TempDir()
+	underTest := &source.Source{}
+	err := sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().SourceParams)
+	is.NoErr(err)
+
+	err = underTest.Open(context.Background(), nil)
+	is.NoErr(err)
+
+	testFiles := addObjectsToBucket(ctx, t, testBucket, "", client, 2)
+	for _, file := range testFiles {
+		rec, err := readAndAssert(ctx, t, underTest, file)
+		is.NoErr(err)
+		is.NoErr(underTest.Ack(ctx, rec.Position))
+	}
+
+	// wait for the first scan, which builds the index
+	time.Sleep(time.Second)
+
+	content := uuid.NewString()
+	buf := strings.NewReader(content)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(testBucket),
+		Key:           aws.String(testFiles[0].key),
+		Body:          buf,
+		ContentLength: aws.Int64(int64(buf.Len())),
+	})
+	is.NoErr(err)
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(testFiles[1].key),
+	})
+	is.NoErr(err)
+
+	// the update and delete are detected without versioning
+	rec, err := readWithTimeout(ctx, underTest, time.Second*10)
+	is.NoErr(err)
+	is.Equal(string(rec.Key.Bytes()), testFiles[0].key)
+	is.Equal(string(rec.Payload.After.Bytes()), content)
+	is.Equal(rec.Operation, opencdc.OperationUpdate)
+	is.NoErr(underTest.Ack(ctx, rec.Position))
+
+	rec, err = readWithTimeout(ctx, underTest, time.Second*10)
+	is.NoErr(err)
+	is.Equal(string(rec.Key.Bytes()), testFiles[1].key)
+	is.Equal(rec.Operation, opencdc.OperationDelete)
+	is.NoErr(underTest.Ack(ctx, rec.Position))
+
+	err = underTest.Teardown(ctx)
+	is.NoErr(err)
+}
+
 func TestSource_CDC_EmptyBucketWithDeletedObjects(t *testing.T) {
 	is := is.New(t)
 	client, cfg := prepareIntegrationTest(t)
@@ -460,6 +647,52 @@ func TestSource_SnapshotWithPrefix(t *testing.T) {
 	is.NoErr(err)
 }
 
+func TestSource_SnapshotMultipleLocations(t *testing.T) {
+	is := is.New(t)
+	client, cfg := prepareIntegrationTest(t)
+
+	ctx := context.Background()
+	testBucket := cfg[config.ConfigKeyAWSBucket]
+	cfg[source.ConfigKeyLocations] = "a/,b/"
+	underTest := &source.Source{}
+	err := sdk.Util.ParseConfig(ctx, cfg, underTest.Config(), s3Conn.Connector.NewSpecification().SourceParams)
+	is.NoErr(err)
+
+	// put an item in each location and one outside of them
+	_ = addObjectsToBucket(ctx, t, testBucket, "c/", client, 1)
+	filesA := addObjectsToBucket(ctx, t, testBucket, "a/", client, 1)
+	filesB := addObjectsToBucket(ctx, t, testBucket, "b/", client, 1)
+
+	err = underTest.Open(ctx, nil)
+	is.NoErr(err)
+
+	// locations take turns, so both records are read first
+	rec, err := readAndAssert(ctx, t, underTest, filesA[0])
+	is.NoErr(err)
+	collection, err := rec.Metadata.GetCollection()
+	is.NoErr(err)
+	is.Equal(collection, testBucket+"/a/")
+
+	rec, err = readAndAssert(ctx, t, underTest, filesB[0])
+	is.NoErr(err)
+	collection, err = rec.Metadata.GetCollection()
+	is.NoErr(err)
+	is.Equal(collection, testBucket+"/b/")
+
+	// the position tracks the progress of both locations
+	positions, err := position.ParseRecordPositions(rec.Position, "")
+	is.NoErr(err)
+	is.Equal(len(positions), 2)
+	is.Equal(positions[testBucket+"/a/"].Type, position.TypeCDC)
+	is.Equal(positions[testBucket+"/b/"].Type, position.TypeCDC)
+
+	_, err = underTest.Read(ctx)
+	is.True(errors.Is(err, sdk.ErrBackoffRetry))
+
+	err = underTest.Teardown(ctx)
+	is.NoErr(err)
+}
+
 func TestSource_CDCWithPrefix(t *testing.T) {
 	is := is.New(t)
 	client, cfg := prepareIntegrationTest(t)
@@ -538,7 +771,12 @@ func newS3Client(cfg map[string]string) (*s3.Client, error) {
 		return nil, err
 	}
 
-	client := s3.NewFromConfig(awsConfig)
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if endpoint := cfg[config.ConfigKeyAWSEndpoint]; endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
 	return client, nil
 }
 
@@ -662,12 +900,20 @@ func parseIntegrationConfig() (map[string]string, error) {
 		return map[string]string{}, errors.New("AWS_REGION env var must be set")
 	}
 
-	return map[string]string{
+	cfg := map[string]string{
 		config.ConfigKeyAWSAccessKeyID:     awsAccessKeyID,
 		config.ConfigKeyAWSSecretAccessKey: awsSecretAccessKey,
 		config.ConfigKeyAWSRegion:          awsRegion,
 		source.ConfigKeyPollingPeriod:      "100ms",
-	}, nil
+	}
+
+	// optional, used to run the tests against an S3-compatible store
+	if awsEndpoint := os.Getenv("AWS_S3_ENDPOINT"); awsEndpoint != "" {
+		cfg[config.ConfigKeyAWSEndpoint] = awsEndpoint
+		cfg[config.ConfigKeyAWSUsePathStyle] = "true"
+	}
+
+	return cfg, nil
 }
 
 var testMetadata = map[string]string{